@@ -0,0 +1,92 @@
+package domain
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const SubdomainSourceAXFR = "axfr"
+
+type ZoneTransfer struct {
+	Nameserver  string    `json:"nameserver"`
+	Addr        string    `json:"addr,omitempty"`
+	Allowed     bool      `json:"allowed"`
+	Records     int       `json:"records,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	AttemptedAt time.Time `json:"attemptedAt"`
+}
+
+// AttemptZoneTransfers tries an AXFR of the domain against every
+// authoritative nameserver in NSRecords. Hostnames from a successful
+// transfer are added to Subdomains.
+func (d *Domain) AttemptZoneTransfers() error {
+	if d.NonPublicDomain {
+		return errors.New("Non public domain")
+	}
+	var transfers []ZoneTransfer
+	for _, ns := range d.NSRecords {
+		if !ns.Active() {
+			continue
+		}
+		res, err := resolveHost(ns.NS)
+		if err != nil || res == nil || len(res.ips) == 0 {
+			zt := ZoneTransfer{Nameserver: ns.NS, AttemptedAt: time.Now(), Error: "unable to resolve nameserver"}
+			if err != nil {
+				zt.Error = err.Error()
+			}
+			transfers = append(transfers, zt)
+			continue
+		}
+		transfers = append(transfers, d.tryZoneTransfer(ns.NS, net.JoinHostPort(res.ips[0], "53")))
+	}
+	d.ZoneTransfers = transfers
+	return nil
+}
+
+func (d *Domain) tryZoneTransfer(nameserver, addr string) ZoneTransfer {
+	zt := ZoneTransfer{Nameserver: nameserver, Addr: addr, AttemptedAt: time.Now()}
+	msg := new(dns.Msg)
+	msg.SetAxfr(dns.Fqdn(d.DomainName))
+	tr := &dns.Transfer{DialTimeout: 5 * time.Second, ReadTimeout: 10 * time.Second}
+	ch, err := tr.In(msg, addr)
+	if err != nil {
+		zt.Error = err.Error()
+		return zt
+	}
+	apex := dns.Fqdn(strings.ToLower(d.DomainName))
+	ips := make(map[string][]string)
+	cnames := make(map[string]string)
+	var names []string
+	for env := range ch {
+		if env.Error != nil {
+			zt.Error = env.Error.Error()
+			return zt
+		}
+		for _, rr := range env.RR {
+			zt.Records++
+			name := strings.ToLower(rr.Header().Name)
+			if name == apex || !dns.IsSubDomain(apex, name) || strings.HasPrefix(name, "_") || strings.HasPrefix(name, "*") {
+				continue
+			}
+			if _, ok := ips[name]; !ok {
+				names = append(names, name)
+				ips[name] = nil
+			}
+			switch r := rr.(type) {
+			case *dns.A:
+				ips[name] = append(ips[name], r.A.String())
+			case *dns.CNAME:
+				cnames[name] = strings.ToLower(r.Target)
+			}
+		}
+	}
+	zt.Allowed = zt.Records > 0
+	for _, name := range names {
+		d.addSubdomain(name, ips[name], cnames[name], SubdomainSourceAXFR)
+	}
+	return zt
+}
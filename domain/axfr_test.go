@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func startTestAXFRServer(t *testing.T, allow bool, records ...string) string {
+	t.Helper()
+	var rrs []dns.RR
+	for _, s := range records {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rrs = append(rrs, rr)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := func(w dns.ResponseWriter, req *dns.Msg) {
+		if !allow || req.Question[0].Qtype != dns.TypeAXFR {
+			m := new(dns.Msg)
+			m.SetRcode(req, dns.RcodeRefused)
+			w.WriteMsg(m)
+			return
+		}
+		ch := make(chan *dns.Envelope)
+		done := make(chan struct{})
+		go func() {
+			new(dns.Transfer).Out(w, req, ch)
+			close(done)
+		}()
+		// A transfer starts and ends with the SOA record
+		ch <- &dns.Envelope{RR: append(append([]dns.RR{}, rrs...), rrs[0])}
+		close(ch)
+		<-done
+	}
+	started := make(chan struct{})
+	server := &dns.Server{Listener: ln, Handler: dns.HandlerFunc(handler), NotifyStartedFunc: func() { close(started) }}
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+	return ln.Addr().String()
+}
+
+func TestTryZoneTransfer(t *testing.T) {
+	records := []string{
+		"example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 3600",
+		"example.com. 3600 IN NS ns1.example.com.",
+		"ns1.example.com. 3600 IN A 192.0.2.53",
+		"intranet.example.com. 3600 IN A 192.0.2.10",
+		"portal.example.com. 3600 IN CNAME intranet.example.com.",
+		"_sip._tcp.example.com. 3600 IN SRV 10 5 5060 sip.example.com.",
+	}
+	allowed := startTestAXFRServer(t, true, records...)
+	refused := startTestAXFRServer(t, false, records...)
+
+	d := &Domain{DomainName: "example.com"}
+	zt := d.tryZoneTransfer("ns1.example.com.", allowed)
+	if !zt.Allowed || zt.Records != len(records)+1 {
+		t.Fatalf("expected transfer of %d records to be allowed, got %+v", len(records)+1, zt)
+	}
+	if len(d.Subdomains) != 3 {
+		t.Fatalf("expected 3 subdomains from the transfer, got %+v", d.Subdomains)
+	}
+	for _, s := range d.Subdomains {
+		if s.Source != SubdomainSourceAXFR {
+			t.Fatalf("expected source %s, got %s", SubdomainSourceAXFR, s.Source)
+		}
+	}
+
+	zt = d.tryZoneTransfer("ns2.example.com.", refused)
+	if zt.Allowed || zt.Error == "" {
+		t.Fatalf("expected refused transfer, got %+v", zt)
+	}
+}
@@ -2,58 +2,192 @@ package domain
 
 import (
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"log"
 	"net"
+	"net/smtp"
+	"slices"
+	"strings"
 	"time"
 )
 
-func (d *Domain) GetCertSANs() error {
-	d.LastRanCertSans = time.Now()
-	dom := d.DomainName
+// ApexHost stands for the domain itself in a list of certificate probe
+// hosts, as it does in a zone file.
+const ApexHost = "@"
+
+// The hosts and ports probed when none are configured. Other ports, such as
+// 8443, are opt-in through CertSANPorts.
+var (
+	DefaultCertSANHosts = []string{ApexHost, "www"}
+	DefaultCertSANPorts = []string{"443"}
+)
+
+// CertProbe is an endpoint to collect a certificate from. StartTLS probes
+// speak SMTP and upgrade the connection before the handshake.
+type CertProbe struct {
+	Host     string `json:"host"`
+	Port     string `json:"port"`
+	StartTLS bool   `json:"starttls,omitempty"`
+}
+
+func (p CertProbe) String() string {
+	s := net.JoinHostPort(p.Host, p.Port)
+	if p.StartTLS {
+		s = "smtp://" + s
+	}
+	return s
+}
+
+// CertProbes builds the probe list for GetCertSANsFrom: every host label
+// (ApexHost for the domain itself) on every port, then optionally each
+// discovered subdomain on 443 and each active MX host over STARTTLS.
+// Empty hosts or ports fall back to the defaults.
+func (d *Domain) CertProbes(hosts, ports []string, subdomains, mx bool) []CertProbe {
+	if len(hosts) == 0 {
+		hosts = DefaultCertSANHosts
+	}
+	if len(ports) == 0 {
+		ports = DefaultCertSANPorts
+	}
+	var probes []CertProbe
+	seen := make(map[CertProbe]bool)
+	add := func(p CertProbe) {
+		p.Host = strings.TrimSuffix(strings.ToLower(p.Host), ".")
+		if p.Host != "" && !seen[p] {
+			seen[p] = true
+			probes = append(probes, p)
+		}
+	}
+	for _, h := range hosts {
+		host := d.DomainName
+		if h != ApexHost {
+			host = h + "." + d.DomainName
+		}
+		for _, port := range ports {
+			add(CertProbe{Host: host, Port: port})
+		}
+	}
+	if subdomains {
+		for _, s := range d.Subdomains {
+			add(CertProbe{Host: s.Name, Port: "443"})
+		}
+	}
+	if mx {
+		for _, m := range d.MXRecords {
+			if m.Active() {
+				add(CertProbe{Host: m.Mx, Port: "25", StartTLS: true})
+			}
+		}
+	}
+	return probes
+}
+
+// fetchCertificates completes a handshake with the probe's endpoint and
+// returns the chain it presented. Verification is skipped so that invalid
+// certificates are still collected.
+func fetchCertificates(p CertProbe) ([]*x509.Certificate, error) {
+	addr := p.Host
+	if res, err := resolveHost(p.Host); err == nil && res != nil && len(res.ips) > 0 {
+		addr = res.ips[0]
+	}
 	dialer := net.Dialer{Timeout: 3 * time.Second}
-	// Use the dialTLS function to connect
-	conn, err := dialer.Dial(
-		"tcp", dom+":443",
-	)
+	conn, err := dialer.Dial("tcp", net.JoinHostPort(addr, p.Port))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer conn.Close()
-	tlsConn := tls.Client(
-		conn, &tls.Config{
-			ServerName:         dom,
-			InsecureSkipVerify: true,
-		},
-	)
-	err = tlsConn.Handshake()
-	if err != nil {
-		return err
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	cfg := &tls.Config{ServerName: p.Host, InsecureSkipVerify: true}
+	if p.StartTLS {
+		c, err := smtp.NewClient(conn, p.Host)
+		if err != nil {
+			return nil, err
+		}
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return nil, errors.New("server does not support STARTTLS")
+		}
+		if err := c.StartTLS(cfg); err != nil {
+			return nil, err
+		}
+		state, _ := c.TLSConnectionState()
+		return state.PeerCertificates, nil
+	}
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
 	}
 	defer tlsConn.Close()
-	cert := tlsConn.ConnectionState().PeerCertificates[0]
-	d.CertOrgNames = cert.Subject.Organization
+	return tlsConn.ConnectionState().PeerCertificates, nil
+}
+
+// GetCertSANs collects certificates from the default probes, the apex and
+// www on 443, and merges their SANs into CertSANs.
+func (d *Domain) GetCertSANs() error {
+	return d.GetCertSANsFrom(d.CertProbes(nil, nil, false, false))
+}
+
+// GetCertSANsFrom collects certificates from each probe (the apex on 443
+// when probes is empty) and merges their SANs into CertSANs, recording the
+// endpoints each SAN was seen on. Certificate holds the first certificate
+// collected. An error is returned only when no probe succeeds.
+func (d *Domain) GetCertSANsFrom(probes []CertProbe) error {
+	d.LastRanCertSans = time.Now()
+	dom := d.DomainName
+	if len(probes) == 0 {
+		probes = []CertProbe{{Host: dom, Port: "443"}}
+	}
 	now := time.Now()
 	domsFound := make(map[string]*MatchedDomain)
 	for _, df := range d.CertSANs {
 		domsFound[df.DomainName] = df
 	}
-	for _, san := range cert.DNSNames {
-		dm, err := NewDomain(san)
+	var errs []error
+	var orgs []string
+	var first *Certificate
+	for _, p := range probes {
+		certs, err := fetchCertificates(p)
 		if err != nil {
-			log.Println("Error parsing domain: ", err)
+			errs = append(errs, err)
 			continue
 		}
-		if dm.DomainName == dom {
+		if len(certs) == 0 {
 			continue
 		}
-		if c, exists := domsFound[dm.DomainName]; !exists {
-			certSAN := &MatchedDomain{CreatedAt: now, UpdatedAt: now, DomainName: dm.DomainName}
-			domsFound[dm.DomainName] = certSAN
-		} else {
+		cert := certs[0]
+		if first == nil {
+			first = newCertificate(p.Host, certs)
+		}
+		for _, o := range cert.Subject.Organization {
+			if !slices.Contains(orgs, o) {
+				orgs = append(orgs, o)
+			}
+		}
+		for _, san := range cert.DNSNames {
+			dm, err := NewDomain(san)
+			if err != nil {
+				log.Println("Error parsing domain: ", err)
+				continue
+			}
+			if dm.DomainName == dom {
+				continue
+			}
+			c, exists := domsFound[dm.DomainName]
+			if !exists {
+				c = &MatchedDomain{CreatedAt: now, DomainName: dm.DomainName}
+				domsFound[dm.DomainName] = c
+			}
 			c.UpdatedAt = now
-			domsFound[dm.DomainName] = c
+			if !slices.Contains(c.Sources, p.String()) {
+				c.Sources = append(c.Sources, p.String())
+			}
 		}
 	}
+	if first == nil {
+		return errors.Join(errs...)
+	}
+	d.Certificate = first
+	d.CertOrgNames = orgs
 	var cs []*MatchedDomain
 	for _, c := range domsFound {
 		cs = append(cs, c)
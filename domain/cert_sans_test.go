@@ -0,0 +1,127 @@
+package domain
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func startTestTLSServer(t *testing.T, cfg *tls.Config) string {
+	t.Helper()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// startTestSMTPServer speaks just enough SMTP for a client to issue
+// STARTTLS and complete the handshake.
+func startTestSMTPServer(t *testing.T, cert tls.Certificate) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { conn.Close() }()
+				r := bufio.NewReader(conn)
+				conn.Write([]byte("220 mail.example.com ESMTP\r\n"))
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+					case strings.HasPrefix(cmd, "EHLO"):
+						conn.Write([]byte("250-mail.example.com\r\n250 STARTTLS\r\n"))
+					case cmd == "STARTTLS":
+						conn.Write([]byte("220 Ready to start TLS\r\n"))
+						conn = tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+						r = bufio.NewReader(conn)
+					case cmd == "QUIT":
+						conn.Write([]byte("221 Bye\r\n"))
+						return
+					default:
+						conn.Write([]byte("502 Not implemented\r\n"))
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestGetCertSANsProbes(t *testing.T) {
+	dnsAddr := startTestDNSServer(t, answerHandler(
+		"www.example.com. 300 IN A 127.0.0.1",
+		"mail.example.com. 300 IN A 127.0.0.1",
+	))
+	useTestResolvers(t, dnsAddr)
+
+	webCert, _ := testCertificate(t, "www.example.com", "example.net")
+	mailCert, _ := testCertificate(t, "mail.example.com", "example-mail.org")
+	_, webPort, _ := net.SplitHostPort(startTestTLSServer(t, &tls.Config{Certificates: []tls.Certificate{webCert}}))
+	_, smtpPort, _ := net.SplitHostPort(startTestSMTPServer(t, mailCert))
+
+	d := &Domain{DomainName: "example.com"}
+	web := CertProbe{Host: "www.example.com", Port: webPort}
+	mail := CertProbe{Host: "mail.example.com", Port: smtpPort, StartTLS: true}
+	if err := d.GetCertSANsFrom([]CertProbe{web, mail}); err != nil {
+		t.Fatal(err)
+	}
+	if d.Certificate == nil || !slices.Contains(d.Certificate.DNSNames, "www.example.com") {
+		t.Fatalf("expected certificate from the first probe, got %+v", d.Certificate)
+	}
+	if len(d.CertSANs) != 2 {
+		t.Fatalf("expected 2 cert SANs, got %+v", d.CertSANs)
+	}
+	for _, c := range d.CertSANs {
+		want := web.String()
+		if c.DomainName == "example-mail.org" {
+			want = mail.String()
+		}
+		if !slices.Equal(c.Sources, []string{want}) {
+			t.Fatalf("expected %s to come from %s, got %v", c.DomainName, want, c.Sources)
+		}
+	}
+}
+
+func TestCertProbes(t *testing.T) {
+	d := &Domain{DomainName: "example.com"}
+	d.Subdomains = []*SubdomainRecord{{Name: "www.example.com"}, {Name: "vpn.example.com"}}
+	d.MXRecords = []MXRecord{{Mx: "mx.example.com."}}
+	probes := d.CertProbes(nil, nil, true, true)
+	want := []CertProbe{
+		{Host: "example.com", Port: "443"},
+		{Host: "www.example.com", Port: "443"},
+		{Host: "vpn.example.com", Port: "443"},
+		{Host: "mx.example.com", Port: "25", StartTLS: true},
+	}
+	if !slices.Equal(probes, want) {
+		t.Fatalf("expected %v, got %v", want, probes)
+	}
+}
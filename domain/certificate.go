@@ -0,0 +1,163 @@
+package domain
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type CertificateDetails struct {
+	Subject            string    `json:"subject"`
+	Issuer             string    `json:"issuer"`
+	SerialNumber       string    `json:"serialNumber"`
+	NotBefore          time.Time `json:"notBefore"`
+	NotAfter           time.Time `json:"notAfter"`
+	SHA256Fingerprint  string    `json:"sha256Fingerprint"`
+	KeyType            string    `json:"keyType"`
+	KeyBits            int       `json:"keyBits"`
+	SignatureAlgorithm string    `json:"signatureAlgorithm"`
+	IsCA               bool      `json:"isCA,omitempty"`
+}
+
+// CertificateProblem is a reason a certificate would fail validation by
+// a browser.
+type CertificateProblem string
+
+const (
+	CertExpired          CertificateProblem = "expired"
+	CertNotYetValid      CertificateProblem = "not_yet_valid"
+	CertHostnameMismatch CertificateProblem = "hostname_mismatch"
+	CertSelfSigned       CertificateProblem = "self_signed"
+	CertUnknownAuthority CertificateProblem = "unknown_authority"
+	CertWeakKey          CertificateProblem = "weak_key"
+)
+
+type CertificateFinding struct {
+	Problem CertificateProblem `json:"problem"`
+	Detail  string             `json:"detail"`
+}
+
+// Certificate is the leaf certificate presented by the domain along with
+// the rest of the chain the server sent.
+type Certificate struct {
+	CertificateDetails
+	Host        string               `json:"host"`
+	DNSNames    []string             `json:"dnsNames,omitempty"`
+	Chain       []CertificateDetails `json:"chain,omitempty"`
+	Verified    bool                 `json:"verified"`
+	VerifyError string               `json:"verifyError,omitempty"`
+	Findings    []CertificateFinding `json:"findings,omitempty"`
+}
+
+func (c *Certificate) HasProblem(p CertificateProblem) bool {
+	for _, f := range c.Findings {
+		if f.Problem == p {
+			return true
+		}
+	}
+	return false
+}
+
+func newCertificateDetails(cert *x509.Certificate) CertificateDetails {
+	fp := sha256.Sum256(cert.Raw)
+	cd := CertificateDetails{
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		SerialNumber:       cert.SerialNumber.Text(16),
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		SHA256Fingerprint:  hex.EncodeToString(fp[:]),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		IsCA:               cert.IsCA,
+	}
+	switch k := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		cd.KeyType = "RSA"
+		cd.KeyBits = k.N.BitLen()
+	case *ecdsa.PublicKey:
+		cd.KeyType = "ECDSA"
+		cd.KeyBits = k.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		cd.KeyType = "Ed25519"
+		cd.KeyBits = len(k) * 8
+	default:
+		cd.KeyType = cert.PublicKeyAlgorithm.String()
+	}
+	return cd
+}
+
+// newCertificate describes the chain presented by host in a handshake,
+// leaf first, checks whether it verifies against Client.RootCAs, or the
+// system roots when that is nil, and records any validity problems found.
+func newCertificate(host string, certs []*x509.Certificate) *Certificate {
+	leaf := certs[0]
+	c := &Certificate{CertificateDetails: newCertificateDetails(leaf), Host: host, DNSNames: leaf.DNSNames}
+	intermediates := x509.NewCertPool()
+	for _, ic := range certs[1:] {
+		c.Chain = append(c.Chain, newCertificateDetails(ic))
+		intermediates.AddCert(ic)
+	}
+	opts := x509.VerifyOptions{Roots: client.RootCAs, Intermediates: intermediates}
+	_, err := leaf.Verify(opts)
+	if err != nil {
+		c.VerifyError = err.Error()
+	} else {
+		c.Verified = true
+	}
+	c.Findings = certificateFindings(host, leaf, opts)
+	return c
+}
+
+// certificateFindings checks each kind of problem separately, where
+// Verify stops at the first.
+func certificateFindings(host string, leaf *x509.Certificate, opts x509.VerifyOptions) []CertificateFinding {
+	var findings []CertificateFinding
+	add := func(p CertificateProblem, format string, args ...any) {
+		findings = append(findings, CertificateFinding{Problem: p, Detail: fmt.Sprintf(format, args...)})
+	}
+	now := time.Now()
+	switch {
+	case now.After(leaf.NotAfter):
+		add(CertExpired, "expired %s", leaf.NotAfter.Format(time.RFC3339))
+		opts.CurrentTime = leaf.NotAfter
+	case now.Before(leaf.NotBefore):
+		add(CertNotYetValid, "not valid until %s", leaf.NotBefore.Format(time.RFC3339))
+		opts.CurrentTime = leaf.NotBefore
+	}
+	if host != "" {
+		if err := leaf.VerifyHostname(host); err != nil {
+			add(CertHostnameMismatch, "%s", err)
+		}
+	}
+	selfSigned := bytes.Equal(leaf.RawIssuer, leaf.RawSubject) &&
+		leaf.CheckSignature(leaf.SignatureAlgorithm, leaf.RawTBSCertificate, leaf.Signature) == nil
+	// Verify the chain at a time the leaf was valid so that an expired
+	// certificate still reports an untrusted issuer
+	_, err := leaf.Verify(opts)
+	var unknown x509.UnknownAuthorityError
+	if errors.As(err, &unknown) {
+		if selfSigned {
+			add(CertSelfSigned, "issued by its own subject %s", leaf.Subject)
+		} else {
+			add(CertUnknownAuthority, "issuer %s is not trusted", leaf.Issuer)
+		}
+	}
+	switch k := leaf.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < 2048 {
+			add(CertWeakKey, "RSA key of %d bits", k.N.BitLen())
+		}
+	case *ecdsa.PublicKey:
+		if k.Curve.Params().BitSize < 256 {
+			add(CertWeakKey, "ECDSA key of %d bits", k.Curve.Params().BitSize)
+		}
+	}
+	return findings
+}
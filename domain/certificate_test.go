@@ -0,0 +1,108 @@
+package domain
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testIssue signs a leaf for hosts with the test CA, applying edit to the
+// template before signing.
+func testIssue(t *testing.T, ca tls.Certificate, key crypto.Signer, edit func(*x509.Certificate), hosts ...string) *x509.Certificate {
+	t.Helper()
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: hosts[0]},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     hosts,
+	}
+	if edit != nil {
+		edit(tmpl)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.Leaf, key.Public(), ca.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestNewCertificate(t *testing.T) {
+	cert, roots := testCertificate(t, "example.com", "www.example.com")
+	certs := []*x509.Certificate{cert.Leaf}
+
+	c := newCertificate("example.com", certs)
+	if c.Verified || c.VerifyError == "" {
+		t.Fatalf("expected self-signed certificate to fail system root verification, got %+v", c)
+	}
+	if !c.HasProblem(CertSelfSigned) || c.HasProblem(CertUnknownAuthority) {
+		t.Fatalf("expected only a self-signed finding, got %+v", c.Findings)
+	}
+	if c.KeyType != "ECDSA" || c.KeyBits != 256 {
+		t.Fatalf("expected ECDSA 256 key, got %s %d", c.KeyType, c.KeyBits)
+	}
+	if c.SerialNumber != "1" || len(c.SHA256Fingerprint) != 64 {
+		t.Fatalf("unexpected serial %q or fingerprint %q", c.SerialNumber, c.SHA256Fingerprint)
+	}
+	if len(c.DNSNames) != 2 || c.Issuer != c.Subject {
+		t.Fatalf("unexpected names or issuer: %+v", c)
+	}
+
+	orig := client.RootCAs
+	client.RootCAs = roots
+	t.Cleanup(func() { client.RootCAs = orig })
+	if c = newCertificate("example.com", certs); !c.Verified || len(c.Findings) != 0 {
+		t.Fatalf("expected certificate to verify against test roots, got %s %+v", c.VerifyError, c.Findings)
+	}
+}
+
+func TestCertificateFindings(t *testing.T) {
+	ca, roots := testCertificate(t, "Test CA")
+	other, _ := testCertificate(t, "Other CA")
+	orig := client.RootCAs
+	client.RootCAs = roots
+	t.Cleanup(func() { client.RootCAs = orig })
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		want CertificateProblem
+	}{
+		{"expired", testIssue(t, ca, key, func(c *x509.Certificate) {
+			c.NotBefore = time.Now().Add(-48 * time.Hour)
+			c.NotAfter = time.Now().Add(-24 * time.Hour)
+		}, "example.com"), CertExpired},
+		{"not yet valid", testIssue(t, ca, key, func(c *x509.Certificate) {
+			c.NotBefore = time.Now().Add(24 * time.Hour)
+		}, "example.com"), CertNotYetValid},
+		{"hostname mismatch", testIssue(t, ca, key, nil, "example.net"), CertHostnameMismatch},
+		{"unknown authority", testIssue(t, other, key, nil, "example.com"), CertUnknownAuthority},
+		{"weak key", testIssue(t, ca, weak, nil, "example.com"), CertWeakKey},
+	}
+	for _, tt := range tests {
+		c := newCertificate("example.com", []*x509.Certificate{tt.cert})
+		if len(c.Findings) != 1 || c.Findings[0].Problem != tt.want {
+			t.Fatalf("%s: expected only %s, got %+v", tt.name, tt.want, c.Findings)
+		}
+	}
+}
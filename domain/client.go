@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"crypto/x509"
 	"net"
 	"net/http"
 	"os"
@@ -16,9 +17,14 @@ var (
 )
 
 type Client struct {
-	DNS   *dns.Client
-	HTTP  *http.Client
-	Whois *WhoisXMLClient
+	DNS          *dns.Client
+	Resolvers    *ResolverPool
+	Iterative    *IterativeResolver
+	TrustAnchors []*dns.DS
+	RootCAs      *x509.CertPool
+	HTTP         *http.Client
+	CT           CTSource
+	Whois        *WhoisXMLClient
 }
 
 func newHTTPClient() *http.Client {
@@ -59,8 +65,12 @@ func newWhoisXMLClient(apiKey string) *WhoisXMLClient {
 func init() {
 	key := os.Getenv("WHOIS_XML_API_KEY")
 	client = &Client{
-		DNS:   new(dns.Client),
-		HTTP:  newHTTPClient(),
-		Whois: newWhoisXMLClient(key),
+		DNS:          new(dns.Client),
+		Resolvers:    newResolverPoolFromEnvironment(),
+		Iterative:    NewIterativeResolver(),
+		TrustAnchors: defaultTrustAnchors(),
+		HTTP:         newHTTPClient(),
+		CT:           NewCrtShSource(),
+		Whois:        newWhoisXMLClient(key),
 	}
 }
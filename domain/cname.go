@@ -0,0 +1,151 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// maxCNAMEChain bounds how many CNAME hops are followed for a single name.
+const maxCNAMEChain = 10
+
+// DefaultCNAMESubdomains are resolved alongside the apex when no subdomains
+// are configured.
+var DefaultCNAMESubdomains = []string{
+	"www",
+	"mail",
+	"blog",
+	"shop",
+	"store",
+	"cdn",
+	"app",
+	"api",
+	"dev",
+	"staging",
+	"docs",
+	"status",
+	"help",
+	"support",
+}
+
+// TakeoverFingerprint is a hosting service whose customers are addressed by
+// CNAME, where a dangling target can be claimed by anyone with an account.
+type TakeoverFingerprint struct {
+	Service  string
+	Suffixes []string
+}
+
+var takeoverFingerprints = []TakeoverFingerprint{
+	{Service: "AWS S3", Suffixes: []string{"s3.amazonaws.com", "s3-website.amazonaws.com"}},
+	{Service: "AWS Elastic Beanstalk", Suffixes: []string{"elasticbeanstalk.com"}},
+	{Service: "Azure", Suffixes: []string{
+		"azurewebsites.net", "cloudapp.net", "cloudapp.azure.com", "trafficmanager.net",
+		"blob.core.windows.net", "azureedge.net", "azure-api.net", "azurefd.net",
+	}},
+	{Service: "Heroku", Suffixes: []string{"herokuapp.com", "herokudns.com"}},
+	{Service: "GitHub Pages", Suffixes: []string{"github.io"}},
+	{Service: "Bitbucket", Suffixes: []string{"bitbucket.io"}},
+	{Service: "Netlify", Suffixes: []string{"netlify.app", "netlify.com"}},
+	{Service: "Vercel", Suffixes: []string{"vercel.app", "now.sh"}},
+	{Service: "Shopify", Suffixes: []string{"myshopify.com"}},
+	{Service: "Fastly", Suffixes: []string{"fastly.net"}},
+	{Service: "Pantheon", Suffixes: []string{"pantheonsite.io"}},
+	{Service: "Ghost", Suffixes: []string{"ghost.io"}},
+	{Service: "Surge", Suffixes: []string{"surge.sh"}},
+	{Service: "Zendesk", Suffixes: []string{"zendesk.com"}},
+	{Service: "Readme.io", Suffixes: []string{"readme.io"}},
+	{Service: "Fly.io", Suffixes: []string{"fly.dev"}},
+}
+
+type CNAMEChain struct {
+	Name             string   `json:"name"`
+	Chain            []string `json:"chain"`
+	Dangling         bool     `json:"dangling,omitempty"`
+	PossibleTakeover string   `json:"possibleTakeover,omitempty"`
+}
+
+// matchTakeoverFingerprint returns the service hosting target, if any.
+func matchTakeoverFingerprint(target string) string {
+	target = strings.TrimSuffix(strings.ToLower(target), ".")
+	for _, fp := range takeoverFingerprints {
+		for _, suffix := range fp.Suffixes {
+			if target == suffix || strings.HasSuffix(target, "."+suffix) {
+				return fp.Service
+			}
+		}
+	}
+	return ""
+}
+
+// GetCNAMEChains resolves the CNAME chains of the apex and the given
+// subdomains (DefaultCNAMESubdomains when empty) and flags chains that end
+// in NXDOMAIN on a known hosting service as possible subdomain takeovers.
+func (d *Domain) GetCNAMEChains(subdomains []string) error {
+	if d.NonPublicDomain {
+		return errors.New("Non public domain")
+	}
+	if len(subdomains) == 0 {
+		subdomains = DefaultCNAMESubdomains
+	}
+	names := []string{d.DomainName}
+	for _, sub := range subdomains {
+		names = append(names, sub+"."+d.DomainName)
+	}
+	var chains []CNAMEChain
+	var errs []error
+	for _, name := range names {
+		chain, err := resolveCNAMEChain(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if chain != nil {
+			chains = append(chains, *chain)
+		}
+	}
+	if len(errs) > 0 && len(errs) == len(names) {
+		return errors.Join(errs...)
+	}
+	d.CNAMEChains = chains
+	return nil
+}
+
+// resolveCNAMEChain follows CNAMEs from name, returning nil when name is not
+// an alias.
+func resolveCNAMEChain(name string) (*CNAMEChain, error) {
+	chain := &CNAMEChain{Name: dns.Fqdn(strings.ToLower(name))}
+	seen := map[string]bool{chain.Name: true}
+	current := chain.Name
+	for len(chain.Chain) < maxCNAMEChain {
+		answer, _, err := queryAnswer(current, dns.TypeCNAME)
+		if errors.Is(err, ErrNXDomain) {
+			if len(chain.Chain) == 0 {
+				return nil, nil
+			}
+			chain.Dangling = true
+			chain.PossibleTakeover = matchTakeoverFingerprint(current)
+			return chain, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		next := ""
+		for _, ans := range answer {
+			if c, ok := ans.(*dns.CNAME); ok && strings.EqualFold(c.Hdr.Name, current) {
+				next = strings.ToLower(c.Target)
+				break
+			}
+		}
+		if next == "" || seen[next] {
+			break
+		}
+		seen[next] = true
+		chain.Chain = append(chain.Chain, next)
+		current = next
+	}
+	if len(chain.Chain) == 0 {
+		return nil, nil
+	}
+	return chain, nil
+}
@@ -0,0 +1,211 @@
+package domain
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const crtShTimeLayout = "2006-01-02T15:04:05"
+
+// maxCrtShResponse caps how much of a crt.sh response is read. Domains with
+// more logged certificates than fit are reported as an error.
+const maxCrtShResponse = 32 << 20
+
+// CTCertificate is a logged certificate as reported by a CTSource.
+type CTCertificate struct {
+	ID          int64     `json:"id"`
+	Issuer      string    `json:"issuer"`
+	Serial      string    `json:"serial"`
+	SubjectOrgs []string  `json:"subjectOrgs,omitempty"`
+	DNSNames    []string  `json:"dnsNames"`
+	NotBefore   time.Time `json:"notBefore"`
+	NotAfter    time.Time `json:"notAfter"`
+}
+
+// CTSource finds every logged certificate naming a domain or any of its
+// subdomains.
+type CTSource interface {
+	Certificates(domain string) ([]CTCertificate, error)
+}
+
+// CrtShSource queries a crt.sh style JSON endpoint. The JSON results carry
+// no subject, so the first MaxDownloads certificates are downloaded to read
+// their subject organisations. Each download is another request to a
+// heavily rate limited service, so none are made by default.
+type CrtShSource struct {
+	BaseURL      string
+	HTTP         *http.Client
+	MaxDownloads int
+}
+
+func NewCrtShSource() *CrtShSource {
+	return &CrtShSource{BaseURL: "https://crt.sh/"}
+}
+
+// SetCTSource replaces the certificate transparency source used by
+// GetCTDomains.
+func SetCTSource(src CTSource) {
+	client.CT = src
+}
+
+type crtShEntry struct {
+	ID           int64  `json:"id"`
+	IssuerName   string `json:"issuer_name"`
+	CommonName   string `json:"common_name"`
+	NameValue    string `json:"name_value"`
+	SerialNumber string `json:"serial_number"`
+	NotBefore    string `json:"not_before"`
+	NotAfter     string `json:"not_after"`
+}
+
+func (s *CrtShSource) httpClient() *http.Client {
+	if s.HTTP != nil {
+		return s.HTTP
+	}
+	return client.HTTP
+}
+
+func (s *CrtShSource) get(query url.Values) ([]byte, error) {
+	u, err := url.Parse(s.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = query.Encode()
+	resp, err := s.httpClient().Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", u.Host, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCrtShResponse+1))
+	if err == nil && len(body) > maxCrtShResponse {
+		return nil, fmt.Errorf("%s response is larger than %d bytes", u.Host, maxCrtShResponse)
+	}
+	return body, err
+}
+
+func (s *CrtShSource) Certificates(domain string) ([]CTCertificate, error) {
+	body, err := s.get(url.Values{"q": {"%." + domain}, "output": {"json"}})
+	if err != nil {
+		return nil, err
+	}
+	var entries []crtShEntry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, err
+	}
+	// crt.sh lists a precertificate and its final certificate separately
+	seen := make(map[string]bool)
+	var certs []CTCertificate
+	for _, e := range entries {
+		key := e.IssuerName + "/" + e.SerialNumber
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		c := CTCertificate{ID: e.ID, Issuer: e.IssuerName, Serial: e.SerialNumber}
+		c.NotBefore, _ = time.Parse(crtShTimeLayout, e.NotBefore)
+		c.NotAfter, _ = time.Parse(crtShTimeLayout, e.NotAfter)
+		for _, name := range append(strings.Split(e.NameValue, "\n"), e.CommonName) {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name != "" && !slices.Contains(c.DNSNames, name) {
+				c.DNSNames = append(c.DNSNames, name)
+			}
+		}
+		if len(certs) < s.MaxDownloads {
+			orgs, err := s.subjectOrgs(e.ID)
+			if err != nil {
+				log.Println("Error downloading certificate: ", err)
+			}
+			c.SubjectOrgs = orgs
+		}
+		certs = append(certs, c)
+	}
+	return certs, nil
+}
+
+func (s *CrtShSource) subjectOrgs(id int64) ([]string, error) {
+	body, err := s.get(url.Values{"d": {strconv.FormatInt(id, 10)}})
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(body); block != nil {
+		body = block.Bytes
+	}
+	cert, err := x509.ParseCertificate(body)
+	if err != nil {
+		return nil, err
+	}
+	return cert.Subject.Organization, nil
+}
+
+// GetCTDomains searches Certificate Transparency logs through client.CT for
+// every certificate issued for the domain and its subdomains. The other
+// registrable domains those certificates name become CTDomains, with
+// FirstSeen and LastSeen set from the earliest and latest certificate
+// naming them.
+func (d *Domain) GetCTDomains() error {
+	d.LastRanCTDomains = time.Now()
+	if d.NonPublicDomain {
+		return errors.New("Non public domain")
+	}
+	if client.CT == nil {
+		return errors.New("No certificate transparency source configured")
+	}
+	certs, err := client.CT.Certificates(d.DomainName)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	domsFound := make(map[string]*MatchedDomain)
+	for _, df := range d.CTDomains {
+		domsFound[df.DomainName] = df
+	}
+	var orgs []string
+	for _, c := range certs {
+		for _, o := range c.SubjectOrgs {
+			if !slices.Contains(orgs, o) {
+				orgs = append(orgs, o)
+			}
+		}
+		for _, name := range c.DNSNames {
+			dm, err := NewDomain(strings.TrimPrefix(name, "*."))
+			if err != nil || dm.DomainName == d.DomainName {
+				continue
+			}
+			md, exists := domsFound[dm.DomainName]
+			if !exists {
+				md = &MatchedDomain{CreatedAt: now, DomainName: dm.DomainName}
+				domsFound[dm.DomainName] = md
+			}
+			md.UpdatedAt = now
+			seen := c.NotBefore
+			if md.FirstSeen == nil || seen.Before(*md.FirstSeen) {
+				md.FirstSeen = &seen
+			}
+			if md.LastSeen == nil || seen.After(*md.LastSeen) {
+				md.LastSeen = &seen
+			}
+		}
+	}
+	slices.Sort(orgs)
+	d.CTOrgNames = orgs
+	var cs []*MatchedDomain
+	for _, c := range domsFound {
+		cs = append(cs, c)
+	}
+	d.CTDomains = cs
+	return nil
+}
@@ -0,0 +1,57 @@
+package domain
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const crtShFixture = `[
+  {"issuer_ca_id":1,"issuer_name":"C=US, O=Let's Encrypt, CN=R3","common_name":"example.com","name_value":"example.com\nwww.example.com\nexample.net","id":101,"entry_timestamp":"2021-03-01T10:00:00.123","not_before":"2021-03-01T09:00:00","not_after":"2021-05-30T09:00:00","serial_number":"0a"},
+  {"issuer_ca_id":1,"issuer_name":"C=US, O=Let's Encrypt, CN=R3","common_name":"example.com","name_value":"example.com\nwww.example.com\nexample.net","id":100,"entry_timestamp":"2021-03-01T10:00:00.001","not_before":"2021-03-01T09:00:00","not_after":"2021-05-30T09:00:00","serial_number":"0a"},
+  {"issuer_ca_id":2,"issuer_name":"C=US, O=DigiCert Inc, CN=DigiCert TLS RSA SHA256 2020 CA1","common_name":"*.example.com","name_value":"*.example.com\n*.example.net\nshop.example.org","id":200,"entry_timestamp":"2023-07-15T12:00:00.500","not_before":"2023-07-15T00:00:00","not_after":"2024-07-15T23:59:59","serial_number":"0b"}
+]`
+
+func TestGetCTDomains(t *testing.T) {
+	cert, _ := testCertificate(t, "example.com")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Leaf.Raw})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("d") != "" {
+			w.Write(certPEM)
+			return
+		}
+		if r.URL.Query().Get("q") != "%.example.com" || r.URL.Query().Get("output") != "json" {
+			http.Error(w, "bad query", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(crtShFixture))
+	}))
+	defer srv.Close()
+
+	orig := client.CT
+	client.CT = &CrtShSource{BaseURL: srv.URL + "/", HTTP: srv.Client(), MaxDownloads: 1}
+	t.Cleanup(func() { client.CT = orig })
+
+	d := &Domain{DomainName: "example.com"}
+	if err := d.GetCTDomains(); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.CTOrgNames) != 1 || d.CTOrgNames[0] != "Test Org" {
+		t.Fatalf("expected subject org from the downloaded certificate, got %v", d.CTOrgNames)
+	}
+	found := make(map[string]*MatchedDomain)
+	for _, c := range d.CTDomains {
+		found[c.DomainName] = c
+	}
+	if len(found) != 2 || found["example.net"] == nil || found["example.org"] == nil {
+		t.Fatalf("expected example.net and example.org, got %+v", d.CTDomains)
+	}
+	md := found["example.net"]
+	first := time.Date(2021, 3, 1, 9, 0, 0, 0, time.UTC)
+	last := time.Date(2023, 7, 15, 0, 0, 0, 0, time.UTC)
+	if !md.FirstSeen.Equal(first) || !md.LastSeen.Equal(last) {
+		t.Fatalf("expected example.net seen from %s to %s, got %s to %s", first, last, md.FirstSeen, md.LastSeen)
+	}
+}
@@ -2,163 +2,502 @@ package domain
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/miekg/dns"
 )
 
-type AAAARecord struct {
+const (
+	DNSRecordAdded   = "added"
+	DNSRecordRemoved = "removed"
+)
+
+// RecordHistory tracks when a DNS record was first and last seen, and when
+// it stopped resolving.
+type RecordHistory struct {
 	CreatedAt time.Time `json:"createdAt,omitempty"`
 	UpdatedAt time.Time `json:"updatedAt,omitempty"`
-	IPV6      string    `json:"ip_v6"`
+	RemovedAt time.Time `json:"removedAt,omitempty"`
+}
+
+func (h *RecordHistory) Active() bool {
+	return h.RemovedAt.IsZero()
+}
+
+func (h *RecordHistory) history() *RecordHistory {
+	return h
+}
+
+// RecordSource is the TTL a record was served with and the resolver that
+// answered the lookup.
+type RecordSource struct {
+	TTL      uint32 `json:"ttl"`
+	Resolver string `json:"resolver,omitempty"`
 }
 
+// DNSRecordChange is an entry in a domain's log of records added and removed
+// between DNS runs.
+type DNSRecordChange struct {
+	Type   string    `json:"type"`
+	Value  string    `json:"value"`
+	Change string    `json:"change"`
+	At     time.Time `json:"at"`
+}
+
+type AAAARecord struct {
+	RecordHistory
+	RecordSource
+	IPV6 string   `json:"ip_v6"`
+	PTR  []string `json:"ptr,omitempty"`
+}
+
+func (r *AAAARecord) key() string { return r.IPV6 }
+
+func (r *AAAARecord) carryOver(old *AAAARecord) { r.PTR = old.PTR }
+
 type ARecord struct {
-	CreatedAt time.Time `json:"createdAt,omitempty"`
-	UpdatedAt time.Time `json:"updatedAt,omitempty"`
-	IP        string    `json:"ip"`
+	RecordHistory
+	RecordSource
+	IP  string   `json:"ip"`
+	PTR []string `json:"ptr,omitempty"`
 }
 
+func (r *ARecord) key() string { return r.IP }
+
+func (r *ARecord) carryOver(old *ARecord) { r.PTR = old.PTR }
+
 type SOARecord struct {
-	CreatedAt time.Time `json:"createdAt,omitempty"`
-	UpdatedAt time.Time `json:"updatedAt,omitempty"`
-	NS        string    `json:"ns,omitempty"`
-	MBox      string    `json:"MBox,omitempty"`
-	Serial    uint32    `json:"serial,omitempty"`
+	RecordHistory
+	RecordSource
+	NS      string `json:"ns,omitempty"`
+	MBox    string `json:"MBox,omitempty"`
+	Serial  uint32 `json:"serial,omitempty"`
+	Refresh uint32 `json:"refresh,omitempty"`
+	Retry   uint32 `json:"retry,omitempty"`
+	Expire  uint32 `json:"expire,omitempty"`
+	MinTTL  uint32 `json:"minTTL,omitempty"`
 }
 
+func (r *SOARecord) key() string { return r.NS + " " + r.MBox }
+
 type MXRecord struct {
-	CreatedAt time.Time `json:"createdAt,omitempty"`
-	UpdatedAt time.Time `json:"updatedAt,omitempty"`
-	Mx        string    `json:"mx,omitempty"`
+	RecordHistory
+	RecordSource
+	Mx         string `json:"mx,omitempty"`
+	Preference uint16 `json:"preference"`
 }
 
-func (d *Domain) QueryMX() error {
-	msg := new(dns.Msg)
-	msg.SetQuestion(dns.Fqdn(d.DomainName), dns.TypeMX)
-	r, err := queryAllServers(msg)
-	if err != nil {
-		return err
-	}
-	foundMx := make(map[string]MXRecord)
-	for _, m := range d.MXRecords {
-		foundMx[m.Mx] = m
-	}
+func (r *MXRecord) key() string { return r.Mx }
+
+type TXTRecord struct {
+	RecordHistory
+	RecordSource
+	TXT string `json:"txt"`
+}
+
+func (r *TXTRecord) key() string { return r.TXT }
+
+type NSRecord struct {
+	RecordHistory
+	RecordSource
+	NS string `json:"ns"`
+}
+
+func (r *NSRecord) key() string { return r.NS }
+
+type CNAMERecord struct {
+	RecordHistory
+	RecordSource
+	Target string `json:"target"`
+}
+
+func (r *CNAMERecord) key() string { return r.Target }
+
+type CAARecord struct {
+	RecordHistory
+	RecordSource
+	Flag  uint8  `json:"flag"`
+	Tag   string `json:"tag"`
+	Value string `json:"value"`
+}
+
+func (r *CAARecord) key() string { return r.Tag + " " + r.Value }
+
+type SRVRecord struct {
+	RecordHistory
+	RecordSource
+	Service  string `json:"service"`
+	Priority uint16 `json:"priority"`
+	Weight   uint16 `json:"weight"`
+	Port     uint16 `json:"port"`
+	Target   string `json:"target"`
+}
+
+func (r *SRVRecord) key() string { return fmt.Sprintf("%s %s:%d", r.Service, r.Target, r.Port) }
+
+// srvServices are the service labels looked up by QuerySRV.
+var srvServices = []string{
+	"_autodiscover._tcp",
+	"_caldav._tcp",
+	"_caldavs._tcp",
+	"_carddav._tcp",
+	"_carddavs._tcp",
+	"_imap._tcp",
+	"_imaps._tcp",
+	"_pop3s._tcp",
+	"_submission._tcp",
+	"_sip._tcp",
+	"_sip._udp",
+	"_sips._tcp",
+	"_sipfederationtls._tcp",
+	"_xmpp-client._tcp",
+	"_xmpp-server._tcp",
+	"_ldap._tcp",
+	"_kerberos._tcp",
+}
+
+type historyRecord interface {
+	history() *RecordHistory
+	key() string
+}
+
+// carriedRecord is implemented by records holding data that other
+// strategies add after the lookup, such as PTR names, which is kept when
+// the record is seen again.
+type carriedRecord[T any] interface {
+	carryOver(old *T)
+}
+
+// mergeRecords reconciles the records found by the latest lookup with the
+// existing ones. Records that are seen again keep their CreatedAt, records
+// that are no longer returned are kept with RemovedAt set, and every
+// addition or removal is written to the domain's DNS change log.
+func mergeRecords[T any, PT interface {
+	*T
+	historyRecord
+}](d *Domain, rrtype string, existing, found []T) []T {
 	now := time.Now()
-	for _, ans := range r.Answer {
-		if a, ok := ans.(*dns.MX); ok {
-			if m, ok := foundMx[a.Mx]; ok {
-				m.UpdatedAt = now
-				foundMx[a.Mx] = m
-			} else {
-				r := MXRecord{
-					CreatedAt: now,
-					UpdatedAt: now,
-					Mx:        a.Mx,
-				}
-				foundMx[a.Mx] = r
+	foundByKey := make(map[string]T)
+	var order []string
+	for _, f := range found {
+		k := PT(&f).key()
+		if _, ok := foundByKey[k]; !ok {
+			order = append(order, k)
+		}
+		foundByKey[k] = f
+	}
+	seen := make(map[string]bool)
+	merged := make([]T, 0, len(existing)+len(found))
+	for _, e := range existing {
+		k := PT(&e).key()
+		old := PT(&e).history()
+		f, ok := foundByKey[k]
+		if !ok {
+			if old.Active() {
+				old.RemovedAt = now
+				d.logDNSChange(rrtype, k, DNSRecordRemoved, now)
 			}
+			merged = append(merged, e)
+			continue
+		}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		if !old.Active() {
+			d.logDNSChange(rrtype, k, DNSRecordAdded, now)
 		}
+		if c, ok := any(PT(&f)).(carriedRecord[T]); ok {
+			c.carryOver(&e)
+		}
+		h := PT(&f).history()
+		h.CreatedAt = old.CreatedAt
+		h.UpdatedAt = now
+		h.RemovedAt = time.Time{}
+		merged = append(merged, f)
 	}
-	var mxs []MXRecord
-	for _, mx := range foundMx {
-		mxs = append(mxs, mx)
+	for _, k := range order {
+		if seen[k] {
+			continue
+		}
+		f := foundByKey[k]
+		h := PT(&f).history()
+		h.CreatedAt = now
+		h.UpdatedAt = now
+		d.logDNSChange(rrtype, k, DNSRecordAdded, now)
+		merged = append(merged, f)
 	}
-	d.MXRecords = mxs
-	return nil
+	return merged
 }
 
-func (d *Domain) QueryA() error {
+func (d *Domain) logDNSChange(rrtype, value, change string, at time.Time) {
+	d.DNSChanges = append(d.DNSChanges, DNSRecordChange{Type: rrtype, Value: value, Change: change, At: at})
+}
+
+// queryAnswer looks up name and returns the answer section along with the
+// resolver that answered.
+func queryAnswer(name string, qtype uint16) ([]dns.RR, string, error) {
 	msg := new(dns.Msg)
-	msg.SetQuestion(dns.Fqdn(d.DomainName), dns.TypeA)
-	r, err := queryAllServers(msg)
+	msg.SetQuestion(dns.Fqdn(name), qtype)
+	r, resolver, err := queryAllServers(msg)
 	if err != nil {
+		return nil, "", err
+	}
+	return r.Answer, resolver, nil
+}
+
+func (d *Domain) QueryMX() error {
+	answer, resolver, err := queryAnswer(d.DomainName, dns.TypeMX)
+	if err != nil && !errors.Is(err, ErrNXDomain) {
 		return err
 	}
-	foundA := make(map[string]ARecord)
-	for _, a := range d.ARecords {
-		foundA[a.IP] = a
+	var found []MXRecord
+	for _, ans := range answer {
+		if a, ok := ans.(*dns.MX); ok {
+			found = append(found, MXRecord{
+				RecordSource: RecordSource{TTL: a.Hdr.Ttl, Resolver: resolver},
+				Mx:           a.Mx,
+				Preference:   a.Preference,
+			})
+		}
 	}
-	now := time.Now()
-	for _, ans := range r.Answer {
+	d.MXRecords = mergeRecords(d, "MX", d.MXRecords, found)
+	return err
+}
+
+func (d *Domain) QueryA() error {
+	answer, resolver, err := queryAnswer(d.DomainName, dns.TypeA)
+	if err != nil && !errors.Is(err, ErrNXDomain) {
+		return err
+	}
+	var found []ARecord
+	for _, ans := range answer {
 		if a, ok := ans.(*dns.A); ok {
-			if ip, ok := foundA[a.A.String()]; ok {
-				ip.UpdatedAt = now
-				foundA[a.A.String()] = ip
-				continue
-			}
-			r := ARecord{IP: a.A.String(), CreatedAt: now, UpdatedAt: now}
-			foundA[a.A.String()] = r
+			found = append(found, ARecord{RecordSource: RecordSource{TTL: a.Hdr.Ttl, Resolver: resolver}, IP: a.A.String()})
 		}
 	}
-	var ips []ARecord
-	for _, ip := range foundA {
-		ips = append(ips, ip)
-	}
-	d.ARecords = ips
-	return nil
+	d.ARecords = mergeRecords(d, "A", d.ARecords, found)
+	return err
 }
 
 func (d *Domain) QueryAAAA() error {
-	msg := new(dns.Msg)
-	msg.SetQuestion(dns.Fqdn(d.DomainName), dns.TypeAAAA)
-	r, err := queryAllServers(msg)
-	if err != nil {
+	answer, resolver, err := queryAnswer(d.DomainName, dns.TypeAAAA)
+	if err != nil && !errors.Is(err, ErrNXDomain) {
 		return err
 	}
-	foundA := make(map[string]AAAARecord)
-	for _, a := range d.AAAARecords {
-		foundA[a.IPV6] = a
-	}
-	now := time.Now()
-	for _, ans := range r.Answer {
+	var found []AAAARecord
+	for _, ans := range answer {
 		if a, ok := ans.(*dns.AAAA); ok {
-			if ip, ok := foundA[a.AAAA.String()]; ok {
-				ip.UpdatedAt = now
-				foundA[a.AAAA.String()] = ip
-				continue
-			}
-			r := AAAARecord{IPV6: a.AAAA.String(), CreatedAt: now, UpdatedAt: now}
-			foundA[a.AAAA.String()] = r
+			found = append(found, AAAARecord{RecordSource: RecordSource{TTL: a.Hdr.Ttl, Resolver: resolver}, IPV6: a.AAAA.String()})
 		}
 	}
-	var ips []AAAARecord
-	for _, ip := range foundA {
-		ips = append(ips, ip)
-	}
-	d.AAAARecords = ips
-	return nil
+	d.AAAARecords = mergeRecords(d, "AAAA", d.AAAARecords, found)
+	return err
 }
 
 func (d *Domain) QuerySOA() error {
-	msg := new(dns.Msg)
-	msg.SetQuestion(dns.Fqdn(d.DomainName), dns.TypeSOA)
-	r, err := queryAllServers(msg)
-	if err != nil {
+	answer, resolver, err := queryAnswer(d.DomainName, dns.TypeSOA)
+	if err != nil && !errors.Is(err, ErrNXDomain) {
 		return err
 	}
-	now := time.Now()
-	var soas []SOARecord
-	for _, ans := range r.Answer {
+	var found []SOARecord
+	for _, ans := range answer {
 		if a, ok := ans.(*dns.SOA); ok {
-			soas = append(soas, SOARecord{CreatedAt: now, UpdatedAt: now, NS: a.Ns, MBox: a.Mbox, Serial: a.Serial})
+			found = append(found, SOARecord{
+				RecordSource: RecordSource{TTL: a.Hdr.Ttl, Resolver: resolver},
+				NS:           a.Ns,
+				MBox:         a.Mbox,
+				Serial:       a.Serial,
+				Refresh:      a.Refresh,
+				Retry:        a.Retry,
+				Expire:       a.Expire,
+				MinTTL:       a.Minttl,
+			})
 		}
 	}
-	d.SOARecords = soas
+	d.SOARecords = mergeRecords(d, "SOA", d.SOARecords, found)
+	return err
+}
+
+func (d *Domain) QueryTXT() error {
+	answer, resolver, err := queryAnswer(d.DomainName, dns.TypeTXT)
+	if err != nil && !errors.Is(err, ErrNXDomain) {
+		return err
+	}
+	var found []TXTRecord
+	for _, ans := range answer {
+		if a, ok := ans.(*dns.TXT); ok {
+			found = append(found, TXTRecord{RecordSource: RecordSource{TTL: a.Hdr.Ttl, Resolver: resolver}, TXT: strings.Join(a.Txt, "")})
+		}
+	}
+	d.TXTRecords = mergeRecords(d, "TXT", d.TXTRecords, found)
+	return err
+}
+
+func (d *Domain) QueryNS() error {
+	answer, resolver, err := queryAnswer(d.DomainName, dns.TypeNS)
+	if err != nil && !errors.Is(err, ErrNXDomain) {
+		return err
+	}
+	var found []NSRecord
+	for _, ans := range answer {
+		if a, ok := ans.(*dns.NS); ok {
+			found = append(found, NSRecord{RecordSource: RecordSource{TTL: a.Hdr.Ttl, Resolver: resolver}, NS: a.Ns})
+		}
+	}
+	d.NSRecords = mergeRecords(d, "NS", d.NSRecords, found)
+	return err
+}
+
+func (d *Domain) QueryCNAME() error {
+	answer, resolver, err := queryAnswer(d.DomainName, dns.TypeCNAME)
+	if err != nil && !errors.Is(err, ErrNXDomain) {
+		return err
+	}
+	var found []CNAMERecord
+	for _, ans := range answer {
+		if a, ok := ans.(*dns.CNAME); ok {
+			found = append(found, CNAMERecord{RecordSource: RecordSource{TTL: a.Hdr.Ttl, Resolver: resolver}, Target: a.Target})
+		}
+	}
+	d.CNAMERecords = mergeRecords(d, "CNAME", d.CNAMERecords, found)
+	return err
+}
+
+func (d *Domain) QueryCAA() error {
+	answer, resolver, err := queryAnswer(d.DomainName, dns.TypeCAA)
+	if err != nil && !errors.Is(err, ErrNXDomain) {
+		return err
+	}
+	var found []CAARecord
+	for _, ans := range answer {
+		if a, ok := ans.(*dns.CAA); ok {
+			found = append(found, CAARecord{
+				RecordSource: RecordSource{TTL: a.Hdr.Ttl, Resolver: resolver},
+				Flag:         a.Flag,
+				Tag:          a.Tag,
+				Value:        a.Value,
+			})
+		}
+	}
+	d.CAARecords = mergeRecords(d, "CAA", d.CAARecords, found)
+	return err
+}
+
+// QuerySRV looks up every name in srvServices. The records are only
+// reconciled when all lookups succeed, so a failing lookup does not mark
+// that service's records as removed.
+func (d *Domain) QuerySRV() error {
+	var found []SRVRecord
+	var errs []error
+	for _, service := range srvServices {
+		answer, resolver, err := queryAnswer(service+"."+d.DomainName, dns.TypeSRV)
+		if errors.Is(err, ErrNXDomain) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, ans := range answer {
+			if a, ok := ans.(*dns.SRV); ok {
+				found = append(found, SRVRecord{
+					RecordSource: RecordSource{TTL: a.Hdr.Ttl, Resolver: resolver},
+					Service:      service,
+					Priority:     a.Priority,
+					Weight:       a.Weight,
+					Port:         a.Port,
+					Target:       a.Target,
+				})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	d.SRVRecords = mergeRecords(d, "SRV", d.SRVRecords, found)
 	return nil
 }
 
+func lookupTXT(name string) ([]string, error) {
+	answer, _, err := queryAnswer(name, dns.TypeTXT)
+	if errors.Is(err, ErrNXDomain) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var txts []string
+	for _, ans := range answer {
+		if a, ok := ans.(*dns.TXT); ok {
+			txts = append(txts, strings.Join(a.Txt, ""))
+		}
+	}
+	return txts, nil
+}
+
+// ednsBufferSize is the advertised EDNS0 UDP payload size, the DNS flag day
+// 2020 recommendation that avoids IP fragmentation.
+const ednsBufferSize = 1232
+
+// RcodeError is returned when a server answers with a response code other
+// than NOERROR. Compare against the Err* values with errors.Is.
+type RcodeError struct {
+	Name  string
+	Rcode int
+}
+
+func (e *RcodeError) Error() string {
+	if e.Name == "" {
+		return dns.RcodeToString[e.Rcode]
+	}
+	return fmt.Sprintf("%s: %s", e.Name, dns.RcodeToString[e.Rcode])
+}
+
+func (e *RcodeError) Is(target error) bool {
+	t, ok := target.(*RcodeError)
+	return ok && t.Rcode == e.Rcode
+}
+
+var (
+	ErrFormErr  = &RcodeError{Rcode: dns.RcodeFormatError}
+	ErrServFail = &RcodeError{Rcode: dns.RcodeServerFailure}
+	ErrNXDomain = &RcodeError{Rcode: dns.RcodeNameError}
+	ErrNotImp   = &RcodeError{Rcode: dns.RcodeNotImplemented}
+	ErrRefused  = &RcodeError{Rcode: dns.RcodeRefused}
+)
+
+// query exchanges msg with nameserver over UDP, retrying over TCP when the
+// answer comes back truncated.
 func query(msg *dns.Msg, nameserver string) (*dns.Msg, error) {
 	r, _, err := client.DNS.Exchange(msg, nameserver)
+	if err != nil || !r.Truncated {
+		return r, err
+	}
+	tcp := &dns.Client{Net: "tcp", Timeout: client.DNS.Timeout}
+	r, _, err = tcp.Exchange(msg, nameserver)
 	return r, err
 }
 
-func queryAllServers(msg *dns.Msg) (*dns.Msg, error) {
-	r, err := query(msg, "8.8.8.8:53")
-	if err == nil {
-		return r, nil
+// queryAllServers sends msg through the resolver pool and reports which
+// resolver answered. A response with any rcode other than NOERROR is
+// returned as an *RcodeError, so an empty answer with a nil error means the
+// name exists but has no such records.
+func queryAllServers(msg *dns.Msg) (*dns.Msg, string, error) {
+	m := msg.Copy()
+	if m.IsEdns0() == nil {
+		m.SetEdns0(ednsBufferSize, false)
+	}
+	r, resolver, err := client.Resolvers.Exchange(m)
+	if err != nil {
+		return nil, "", err
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		return nil, resolver, &RcodeError{Name: m.Question[0].Name, Rcode: r.Rcode}
 	}
-	return nil, errors.New("Failed to query all servers")
+	return r, resolver, nil
 }
 
 func (d *Domain) GetDNSRecords() []error {
@@ -183,5 +522,103 @@ func (d *Domain) GetDNSRecords() []error {
 	if err != nil {
 		errs = append(errs, err)
 	}
+	err = d.QueryTXT()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	err = d.QueryNS()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	err = d.QueryCNAME()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	err = d.QueryCAA()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	err = d.QuerySRV()
+	if err != nil {
+		errs = append(errs, err)
+	}
 	return errs
 }
+
+// lookupPTR returns the reverse DNS names of ip.
+func lookupPTR(ip string) ([]string, error) {
+	arpa, err := dns.ReverseAddr(ip)
+	if err != nil {
+		return nil, err
+	}
+	answer, _, err := queryAnswer(arpa, dns.TypePTR)
+	if errors.Is(err, ErrNXDomain) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ptrs []string
+	for _, ans := range answer {
+		if p, ok := ans.(*dns.PTR); ok {
+			ptrs = append(ptrs, strings.ToLower(p.Ptr))
+		}
+	}
+	return ptrs, nil
+}
+
+// GetPTRDomains looks up the PTR names of every active A and AAAA record and
+// collects the registrable domains they belong to, which usually name
+// whoever operates the hosting.
+func (d *Domain) GetPTRDomains() error {
+	d.LastRanPTRDomains = time.Now()
+	if d.NonPublicDomain {
+		return errors.New("Non public domain")
+	}
+	var hosts []string
+	var errs []error
+	for i := range d.ARecords {
+		a := &d.ARecords[i]
+		if !a.Active() {
+			continue
+		}
+		ptrs, err := lookupPTR(a.IP)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		a.PTR = ptrs
+		hosts = append(hosts, ptrs...)
+	}
+	for i := range d.AAAARecords {
+		a := &d.AAAARecords[i]
+		if !a.Active() {
+			continue
+		}
+		ptrs, err := lookupPTR(a.IPV6)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		a.PTR = ptrs
+		hosts = append(hosts, ptrs...)
+	}
+	domsFound := make(map[string]*MatchedDomain)
+	for _, df := range d.PTRDomains {
+		domsFound[df.DomainName] = df
+	}
+	now := time.Now()
+	for _, dom := range d.registrableDomains(hosts) {
+		if df, exists := domsFound[dom]; !exists {
+			domsFound[dom] = &MatchedDomain{CreatedAt: now, UpdatedAt: now, DomainName: dom}
+		} else {
+			df.UpdatedAt = now
+		}
+	}
+	var pd []*MatchedDomain
+	for _, df := range domsFound {
+		pd = append(pd, df)
+	}
+	d.PTRDomains = pd
+	return errors.Join(errs...)
+}
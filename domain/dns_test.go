@@ -0,0 +1,258 @@
+package domain
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func startTestDNSServer(t *testing.T, handler dns.HandlerFunc) string {
+	t.Helper()
+	return startTestDNSServerAt(t, "127.0.0.1:0", handler)
+}
+
+func startTestDNSServerAt(t *testing.T, addr string, handler dns.HandlerFunc) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		t.Fatalf("error listening: %s", err.Error())
+	}
+	started := make(chan struct{})
+	server := &dns.Server{PacketConn: pc, Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+	return pc.LocalAddr().String()
+}
+
+func servfailHandler(w dns.ResponseWriter, req *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetRcode(req, dns.RcodeServerFailure)
+	w.WriteMsg(m)
+}
+
+func answerFor(req *dns.Msg, rrs ...string) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(req)
+	for _, s := range rrs {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			panic(err)
+		}
+		if rr.Header().Rrtype == req.Question[0].Qtype && rr.Header().Name == req.Question[0].Name {
+			m.Answer = append(m.Answer, rr)
+		}
+	}
+	return m
+}
+
+func answerHandler(rrs ...string) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, req *dns.Msg) {
+		w.WriteMsg(answerFor(req, rrs...))
+	}
+}
+
+func useTestResolvers(t *testing.T, nameservers ...string) {
+	t.Helper()
+	prev := client.Resolvers
+	if err := SetResolvers(nameservers...); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Resolvers = prev })
+}
+
+func TestQueryTXTAndNS(t *testing.T) {
+	addr := startTestDNSServer(t, answerHandler(
+		`example.com. 300 IN TXT "v=spf1 " "-all"`,
+		"example.com. 300 IN NS ns1.example.net.",
+		"example.com. 300 IN NS ns2.example.net.",
+	))
+	useTestResolvers(t, addr)
+
+	d := &Domain{DomainName: "example.com"}
+	if err := d.QueryTXT(); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.TXTRecords) != 1 || d.TXTRecords[0].TXT != "v=spf1 -all" {
+		t.Fatalf("unexpected TXT records: %+v", d.TXTRecords)
+	}
+	if d.TXTRecords[0].TTL != 300 || d.TXTRecords[0].Resolver != addr {
+		t.Fatalf("expected TTL 300 from %s, got %d from %s", addr, d.TXTRecords[0].TTL, d.TXTRecords[0].Resolver)
+	}
+	if err := d.QueryNS(); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.NSRecords) != 2 {
+		t.Fatalf("expected 2 NS records, got %d", len(d.NSRecords))
+	}
+}
+
+func TestQueryTruncatedFallsBackToTCP(t *testing.T) {
+	handler := func(w dns.ResponseWriter, req *dns.Msg) {
+		m := answerFor(req, `example.com. 300 IN TXT "v=spf1 -all"`)
+		if _, udp := w.RemoteAddr().(*net.UDPAddr); udp {
+			m.Answer = nil
+			m.Truncated = true
+		}
+		w.WriteMsg(m)
+	}
+	addr := startTestDNSServer(t, handler)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("unable to listen on tcp %s: %s", addr, err.Error())
+	}
+	started := make(chan struct{})
+	server := &dns.Server{Listener: ln, Handler: dns.HandlerFunc(handler), NotifyStartedFunc: func() { close(started) }}
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+	useTestResolvers(t, addr)
+
+	d := &Domain{DomainName: "example.com"}
+	if err := d.QueryTXT(); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.TXTRecords) != 1 {
+		t.Fatalf("expected 1 TXT record after TCP retry, got %d", len(d.TXTRecords))
+	}
+}
+
+func TestQueryNXDomain(t *testing.T) {
+	addr := startTestDNSServer(t, func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(req, dns.RcodeNameError)
+		w.WriteMsg(m)
+	})
+	useTestResolvers(t, addr)
+
+	d := &Domain{DomainName: "example.com"}
+	err := d.QueryA()
+	if !errors.Is(err, ErrNXDomain) {
+		t.Fatalf("expected NXDOMAIN error, got %v", err)
+	}
+	if errors.Is(err, ErrServFail) {
+		t.Fatalf("NXDOMAIN error should not match SERVFAIL")
+	}
+}
+
+func TestQueryATracksRemovedRecords(t *testing.T) {
+	var ip atomic.Value
+	ip.Store("192.0.2.1")
+	addr := startTestDNSServer(t, func(w dns.ResponseWriter, req *dns.Msg) {
+		w.WriteMsg(answerFor(req, "example.com. 300 IN A "+ip.Load().(string)))
+	})
+	useTestResolvers(t, addr)
+
+	d := &Domain{DomainName: "example.com"}
+	if err := d.QueryA(); err != nil {
+		t.Fatal(err)
+	}
+	ip.Store("192.0.2.2")
+	if err := d.QueryA(); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.ARecords) != 2 {
+		t.Fatalf("expected 2 A records, got %d", len(d.ARecords))
+	}
+	for _, a := range d.ARecords {
+		if a.Active() != (a.IP == "192.0.2.2") {
+			t.Fatalf("unexpected active state for %s: removed at %s", a.IP, a.RemovedAt)
+		}
+	}
+	expected := []string{"added 192.0.2.1", "removed 192.0.2.1", "added 192.0.2.2"}
+	if len(d.DNSChanges) != len(expected) {
+		t.Fatalf("expected %d changes, got %+v", len(expected), d.DNSChanges)
+	}
+	for i, c := range d.DNSChanges {
+		if got := c.Change + " " + c.Value; got != expected[i] {
+			t.Fatalf("expected change %q, got %q", expected[i], got)
+		}
+	}
+}
+
+func TestGetCNAMEChains(t *testing.T) {
+	records := []string{
+		"www.example.com. 300 IN CNAME example.cdn.example.net.",
+		"example.cdn.example.net. 300 IN CNAME edge.example.org.",
+		"shop.example.com. 300 IN CNAME gone-store.herokuapp.com.",
+	}
+	addr := startTestDNSServer(t, func(w dns.ResponseWriter, req *dns.Msg) {
+		m := answerFor(req, records...)
+		switch req.Question[0].Name {
+		case "example.com.", "edge.example.org.":
+		default:
+			if len(m.Answer) == 0 {
+				m.Rcode = dns.RcodeNameError
+			}
+		}
+		w.WriteMsg(m)
+	})
+	useTestResolvers(t, addr)
+
+	d := &Domain{DomainName: "example.com"}
+	if err := d.GetCNAMEChains([]string{"www", "shop", "missing"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.CNAMEChains) != 2 {
+		t.Fatalf("expected 2 CNAME chains, got %+v", d.CNAMEChains)
+	}
+	for _, c := range d.CNAMEChains {
+		switch c.Name {
+		case "www.example.com.":
+			if len(c.Chain) != 2 || c.Dangling {
+				t.Fatalf("unexpected chain for www: %+v", c)
+			}
+		case "shop.example.com.":
+			if !c.Dangling || c.PossibleTakeover != "Heroku" {
+				t.Fatalf("expected shop to be a possible Heroku takeover, got %+v", c)
+			}
+		default:
+			t.Fatalf("unexpected chain %+v", c)
+		}
+	}
+}
+
+func TestGetPTRDomains(t *testing.T) {
+	addr := startTestDNSServer(t, answerHandler(
+		"1.2.0.192.in-addr.arpa. 300 IN PTR server-192-0-2-1.hosting.example.net.",
+		"2.2.0.192.in-addr.arpa. 300 IN PTR www.example.com.",
+	))
+	useTestResolvers(t, addr)
+
+	d := &Domain{DomainName: "example.com", ARecords: []ARecord{{IP: "192.0.2.1"}, {IP: "192.0.2.2"}}}
+	if err := d.GetPTRDomains(); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.ARecords[0].PTR) != 1 || d.ARecords[0].PTR[0] != "server-192-0-2-1.hosting.example.net." {
+		t.Fatalf("unexpected PTR names: %v", d.ARecords[0].PTR)
+	}
+	ptrDomains := d.GetAllMatchedDomains().PTRDomains
+	if len(ptrDomains) != 1 || ptrDomains[0] != "example.net" {
+		t.Fatalf("expected PTR domain example.net, got %v", ptrDomains)
+	}
+}
+
+func TestQueryAKeepsPTR(t *testing.T) {
+	addr := startTestDNSServer(t, answerHandler(
+		"example.com. 300 IN A 192.0.2.1",
+		"1.2.0.192.in-addr.arpa. 300 IN PTR server-192-0-2-1.hosting.example.net.",
+	))
+	useTestResolvers(t, addr)
+
+	d := &Domain{DomainName: "example.com"}
+	if err := d.QueryA(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.GetPTRDomains(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.QueryA(); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.ARecords) != 1 || len(d.ARecords[0].PTR) != 1 {
+		t.Fatalf("expected PTR names to survive a DNS refresh, got %+v", d.ARecords)
+	}
+}
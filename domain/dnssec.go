@@ -0,0 +1,274 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	DNSSECSecure        = "secure"
+	DNSSECInsecure      = "insecure"
+	DNSSECBogus         = "bogus"
+	DNSSECIndeterminate = "indeterminate"
+)
+
+// rootTrustAnchors are the IANA root zone KSK DS records (KSK-2017 and
+// KSK-2024).
+var rootTrustAnchors = []string{
+	". 172800 IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+	". 172800 IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+}
+
+type DNSSECStatus struct {
+	Signed     bool     `json:"signed"`
+	Status     string   `json:"status"`
+	Reason     string   `json:"reason,omitempty"`
+	Algorithms []string `json:"algorithms,omitempty"`
+}
+
+func parseTrustAnchors(records []string) ([]*dns.DS, error) {
+	var anchors []*dns.DS
+	for _, r := range records {
+		rr, err := dns.NewRR(r)
+		if err != nil {
+			return nil, err
+		}
+		ds, ok := rr.(*dns.DS)
+		if !ok {
+			return nil, fmt.Errorf("trust anchor is not a DS record: %s", r)
+		}
+		anchors = append(anchors, ds)
+	}
+	return anchors, nil
+}
+
+func defaultTrustAnchors() []*dns.DS {
+	anchors, _ := parseTrustAnchors(rootTrustAnchors)
+	return anchors
+}
+
+// SetTrustAnchors replaces the DS records DNSSEC validation starts from.
+func SetTrustAnchors(records ...string) error {
+	anchors, err := parseTrustAnchors(records)
+	if err != nil {
+		return err
+	}
+	client.TrustAnchors = anchors
+	return nil
+}
+
+// GetDNSSECStatus validates the chain of trust from the configured trust
+// anchors down to the domain. Missing DS records are taken at face value;
+// NSEC/NSEC3 denial of existence proofs are not checked.
+func (d *Domain) GetDNSSECStatus() error {
+	if d.NonPublicDomain {
+		return errors.New("Non public domain")
+	}
+	status, err := validateDNSSEC(dns.Fqdn(d.DomainName), client.TrustAnchors)
+	d.DNSSEC = status
+	return err
+}
+
+func validateDNSSEC(name string, anchors []*dns.DS) (*DNSSECStatus, error) {
+	status := &DNSSECStatus{}
+	keys, _, err := lookupDNSSEC(name, dns.TypeDNSKEY)
+	if err != nil {
+		return status.indeterminate(err)
+	}
+	status.Signed = len(keys) > 0
+	for _, k := range keys {
+		alg := dns.AlgorithmToString[k.(*dns.DNSKEY).Algorithm]
+		if !slices.Contains(status.Algorithms, alg) {
+			status.Algorithms = append(status.Algorithms, alg)
+		}
+	}
+
+	zone, trusted := anchorFor(name, anchors)
+	if zone == "" {
+		return status.indeterminate(fmt.Errorf("no trust anchor for %s", name))
+	}
+	zoneKeys, err := validateZoneKeys(zone, trusted)
+	if err != nil {
+		return status.bogus(err)
+	}
+	labels := dns.SplitDomainName(name)
+	for i := len(labels) - dns.CountLabel(zone) - 1; i >= 0; i-- {
+		child := dns.Fqdn(strings.Join(labels[i:], "."))
+		dsRRs, dsSigs, err := lookupDNSSEC(child, dns.TypeDS)
+		if err != nil {
+			return status.indeterminate(err)
+		}
+		if len(dsRRs) == 0 {
+			if child == name {
+				status.Status = DNSSECInsecure
+				status.Reason = fmt.Sprintf("no DS record for %s in %s", child, zone)
+				return status, nil
+			}
+			childKeys, _, err := lookupDNSSEC(child, dns.TypeDNSKEY)
+			if err != nil {
+				return status.indeterminate(err)
+			}
+			if len(childKeys) > 0 {
+				status.Status = DNSSECInsecure
+				status.Reason = fmt.Sprintf("insecure delegation to %s", child)
+				return status, nil
+			}
+			// Not a zone cut, keep validating with the parent's keys
+			continue
+		}
+		if err := verifyRRset(dsRRs, dsSigs, zoneKeys, zone); err != nil {
+			return status.bogus(fmt.Errorf("DS for %s: %w", child, err))
+		}
+		var ds []*dns.DS
+		for _, rr := range dsRRs {
+			ds = append(ds, rr.(*dns.DS))
+		}
+		zone = child
+		zoneKeys, err = validateZoneKeys(child, ds)
+		if err != nil {
+			return status.bogus(err)
+		}
+	}
+
+	soa, soaSigs, err := lookupDNSSEC(name, dns.TypeSOA)
+	if err != nil {
+		return status.indeterminate(err)
+	}
+	if err := verifyRRset(soa, soaSigs, zoneKeys, zone); err != nil {
+		return status.bogus(fmt.Errorf("SOA for %s: %w", name, err))
+	}
+	status.Status = DNSSECSecure
+	return status, nil
+}
+
+func (s *DNSSECStatus) indeterminate(err error) (*DNSSECStatus, error) {
+	s.Status = DNSSECIndeterminate
+	s.Reason = err.Error()
+	return s, err
+}
+
+func (s *DNSSECStatus) bogus(err error) (*DNSSECStatus, error) {
+	s.Status = DNSSECBogus
+	s.Reason = err.Error()
+	return s, nil
+}
+
+// anchorFor returns the closest trust anchor zone enclosing name.
+func anchorFor(name string, anchors []*dns.DS) (string, []*dns.DS) {
+	zone := ""
+	var ds []*dns.DS
+	for _, a := range anchors {
+		owner := dns.CanonicalName(a.Hdr.Name)
+		if !dns.IsSubDomain(owner, name) {
+			continue
+		}
+		switch {
+		case zone == "" || dns.CountLabel(owner) > dns.CountLabel(zone):
+			zone = owner
+			ds = []*dns.DS{a}
+		case owner == zone:
+			ds = append(ds, a)
+		}
+	}
+	return zone, ds
+}
+
+// lookupDNSSEC queries name with the DO bit set and checking disabled, so the
+// signatures come back even when the resolver itself would reject them.
+func lookupDNSSEC(name string, qtype uint16) ([]dns.RR, []*dns.RRSIG, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(name, qtype)
+	msg.SetEdns0(ednsBufferSize, true)
+	msg.CheckingDisabled = true
+	r, _, err := queryAllServers(msg)
+	if errors.Is(err, ErrNXDomain) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var rrs []dns.RR
+	var sigs []*dns.RRSIG
+	for _, ans := range r.Answer {
+		if !strings.EqualFold(ans.Header().Name, name) {
+			continue
+		}
+		if sig, ok := ans.(*dns.RRSIG); ok {
+			if sig.TypeCovered == qtype {
+				sigs = append(sigs, sig)
+			}
+			continue
+		}
+		if ans.Header().Rrtype == qtype {
+			rrs = append(rrs, ans)
+		}
+	}
+	return rrs, sigs, nil
+}
+
+// validateZoneKeys fetches the DNSKEY set of zone and checks it is signed by
+// a key matching one of the trusted DS records.
+func validateZoneKeys(zone string, trusted []*dns.DS) ([]*dns.DNSKEY, error) {
+	rrs, sigs, err := lookupDNSSEC(zone, dns.TypeDNSKEY)
+	if err != nil {
+		return nil, err
+	}
+	if len(rrs) == 0 {
+		return nil, fmt.Errorf("no DNSKEY records for %s", zone)
+	}
+	var keys, ksks []*dns.DNSKEY
+	for _, rr := range rrs {
+		key := rr.(*dns.DNSKEY)
+		keys = append(keys, key)
+		for _, ds := range trusted {
+			if key.KeyTag() != ds.KeyTag || key.Algorithm != ds.Algorithm {
+				continue
+			}
+			if kds := key.ToDS(ds.DigestType); kds != nil && strings.EqualFold(kds.Digest, ds.Digest) {
+				ksks = append(ksks, key)
+			}
+		}
+	}
+	if len(ksks) == 0 {
+		return nil, fmt.Errorf("no DNSKEY for %s matches its DS records", zone)
+	}
+	if err := verifyRRset(rrs, sigs, ksks, zone); err != nil {
+		return nil, fmt.Errorf("DNSKEY for %s: %w", zone, err)
+	}
+	return keys, nil
+}
+
+func verifyRRset(rrs []dns.RR, sigs []*dns.RRSIG, keys []*dns.DNSKEY, signer string) error {
+	if len(rrs) == 0 {
+		return errors.New("no records to verify")
+	}
+	if len(sigs) == 0 {
+		return errors.New("no RRSIG records")
+	}
+	err := errors.New("no RRSIG made by a trusted key")
+	for _, sig := range sigs {
+		if !strings.EqualFold(sig.SignerName, signer) {
+			continue
+		}
+		for _, key := range keys {
+			if key.KeyTag() != sig.KeyTag || key.Algorithm != sig.Algorithm {
+				continue
+			}
+			if !sig.ValidityPeriod(time.Now()) {
+				err = errors.New("RRSIG is outside its validity period")
+				continue
+			}
+			if verr := sig.Verify(key, rrs); verr != nil {
+				err = verr
+				continue
+			}
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,103 @@
+package domain
+
+import (
+	"crypto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func testDNSKEY(t *testing.T, zone string) (*dns.DNSKEY, crypto.Signer) {
+	t.Helper()
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := key.Generate(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, priv.(crypto.Signer)
+}
+
+func testSign(t *testing.T, key *dns.DNSKEY, priv crypto.Signer, rrset ...dns.RR) *dns.RRSIG {
+	t.Helper()
+	sig := &dns.RRSIG{
+		Algorithm:  key.Algorithm,
+		SignerName: key.Hdr.Name,
+		KeyTag:     key.KeyTag(),
+		Inception:  uint32(time.Now().Add(-time.Hour).Unix()),
+		Expiration: uint32(time.Now().Add(time.Hour).Unix()),
+	}
+	if err := sig.Sign(priv, rrset); err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+func testSOA(t *testing.T, zone string) dns.RR {
+	t.Helper()
+	rr, err := dns.NewRR(zone + " 3600 IN SOA ns1." + zone + " hostmaster." + zone + " 1 7200 3600 1209600 3600")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rr
+}
+
+func zoneHandler(rrs []dns.RR) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, req *dns.Msg) {
+		q := req.Question[0]
+		m := new(dns.Msg)
+		m.SetReply(req)
+		for _, rr := range rrs {
+			if !strings.EqualFold(rr.Header().Name, q.Name) {
+				continue
+			}
+			if sig, ok := rr.(*dns.RRSIG); ok && sig.TypeCovered == q.Qtype || rr.Header().Rrtype == q.Qtype {
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+		w.WriteMsg(m)
+	}
+}
+
+func TestValidateDNSSEC(t *testing.T) {
+	rootKey, rootPriv := testDNSKEY(t, "test.")
+	childKey, childPriv := testDNSKEY(t, "example.test.")
+	strayKey, strayPriv := testDNSKEY(t, "bad.test.")
+	otherKey, _ := testDNSKEY(t, "bad.test.")
+
+	childDS := childKey.ToDS(dns.SHA256)
+	childSOA := testSOA(t, "example.test.")
+	badDS := otherKey.ToDS(dns.SHA256)
+	rrs := []dns.RR{
+		rootKey, testSign(t, rootKey, rootPriv, rootKey),
+		childDS, testSign(t, rootKey, rootPriv, childDS),
+		childKey, testSign(t, childKey, childPriv, childKey),
+		childSOA, testSign(t, childKey, childPriv, childSOA),
+		testSOA(t, "insecure.test."),
+		badDS, testSign(t, rootKey, rootPriv, badDS),
+		strayKey, testSign(t, strayKey, strayPriv, strayKey),
+	}
+	addr := startTestDNSServer(t, zoneHandler(rrs))
+	useTestResolvers(t, addr)
+	anchors := []*dns.DS{rootKey.ToDS(dns.SHA256)}
+
+	for name, expected := range map[string]string{
+		"example.test.":  DNSSECSecure,
+		"insecure.test.": DNSSECInsecure,
+		"bad.test.":      DNSSECBogus,
+	} {
+		status, err := validateDNSSEC(name, anchors)
+		if err != nil {
+			t.Fatalf("unexpected error validating %s: %s", name, err.Error())
+		}
+		if status.Status != expected {
+			t.Fatalf("expected %s to be %s, got %s (%s)", name, expected, status.Status, status.Reason)
+		}
+	}
+}
@@ -11,37 +11,74 @@ import (
 )
 
 type Domain struct {
-	DomainName            string           `json:"domainName,omitempty"`
-	CreatedAt             time.Time        `json:"createdAt,omitempty"`
-	UpdatedAt             time.Time        `json:"updatedAt,omitempty"`
-	NonPublicDomain       bool             `json:"nonPublicDomain,omitempty"`
-	Hostname              string           `json:"hostname,omitempty"`
-	Subdomain             string           `json:"subdomain,omitempty"`
-	Suffix                string           `json:"suffix,omitempty"`
-	SuccessfulWebLanding  bool             `json:"successfulWebLanding,omitempty"`
-	WebRedirectURLFinal   string           `json:"webRedirectURLFinal,omitempty"`
-	LastRanWebRedirect    time.Time        `json:"lastRanWebRedirect,omitempty"`
-	LastRanDns            time.Time        `json:"lastRanDNS,omitempty"`
-	LastRanCertSans       time.Time        `json:"lastRanCertSANs,omitempty"`
-	LastRanSitemapParse   time.Time        `json:"lastRanSitemapParse,omitempty"`
-	LastRanWhois          time.Time        `json:"LastRanWhois,omitempty"`
-	LastRanReverseWhois   time.Time        `json:"LastRanReverseWhois,omitempty"`
-	ARecords              []ARecord        `json:"aRecords"`
-	AAAARecords           []AAAARecord     `json:"aaaaRecords"`
-	MXRecords             []MXRecord       `json:"mxRecords"`
-	SOARecords            []SOARecord      `json:"soaRecords"`
-	Sitemaps              []*Sitemap       `json:"sitemaps"`
-	WebRedirectDomains    []*MatchedDomain `json:"webRedirectDomains"`
-	CertSANs              []*MatchedDomain `json:"certSANs"`
-	SitemapWebDomains     []*MatchedDomain `json:"sitemapWebDomains"`
-	SitemapContactDomains []*MatchedDomain `json:"sitemapContactDomains"`
-	ReverseWhoisDomains   []*MatchedDomain `json:"reverseWhoisDomains"`
+	DomainName                string             `json:"domainName,omitempty"`
+	CreatedAt                 time.Time          `json:"createdAt,omitempty"`
+	UpdatedAt                 time.Time          `json:"updatedAt,omitempty"`
+	NonPublicDomain           bool               `json:"nonPublicDomain,omitempty"`
+	Hostname                  string             `json:"hostname,omitempty"`
+	Subdomain                 string             `json:"subdomain,omitempty"`
+	Suffix                    string             `json:"suffix,omitempty"`
+	SuccessfulWebLanding      bool               `json:"successfulWebLanding,omitempty"`
+	WebRedirectURLFinal       string             `json:"webRedirectURLFinal,omitempty"`
+	LastRanWebRedirect        time.Time          `json:"lastRanWebRedirect,omitempty"`
+	LastRanDns                time.Time          `json:"lastRanDNS,omitempty"`
+	LastRanCertSans           time.Time          `json:"lastRanCertSANs,omitempty"`
+	LastRanSitemapParse       time.Time          `json:"lastRanSitemapParse,omitempty"`
+	LastRanWhois              time.Time          `json:"LastRanWhois,omitempty"`
+	LastRanReverseWhois       time.Time          `json:"LastRanReverseWhois,omitempty"`
+	LastRanEmailSecurity      time.Time          `json:"lastRanEmailSecurity,omitempty"`
+	LastRanEmailPolicyDomains time.Time          `json:"lastRanEmailPolicyDomains,omitempty"`
+	LastRanSubdomainEnum      time.Time          `json:"lastRanSubdomainEnum,omitempty"`
+	LastRanPTRDomains         time.Time          `json:"lastRanPTRDomains,omitempty"`
+	LastRanCTDomains          time.Time          `json:"lastRanCTDomains,omitempty"`
+	LastRanJARM               time.Time          `json:"lastRanJARM,omitempty"`
+	LastRanOutboundLinks      time.Time          `json:"lastRanOutboundLinks,omitempty"`
+	ARecords                  []ARecord          `json:"aRecords"`
+	AAAARecords               []AAAARecord       `json:"aaaaRecords"`
+	MXRecords                 []MXRecord         `json:"mxRecords"`
+	SOARecords                []SOARecord        `json:"soaRecords"`
+	TXTRecords                []TXTRecord        `json:"txtRecords"`
+	NSRecords                 []NSRecord         `json:"nsRecords"`
+	CNAMERecords              []CNAMERecord      `json:"cnameRecords"`
+	CAARecords                []CAARecord        `json:"caaRecords"`
+	SRVRecords                []SRVRecord        `json:"srvRecords"`
+	DNSChanges                []DNSRecordChange  `json:"dnsChanges"`
+	CNAMEChains               []CNAMEChain       `json:"cnameChains"`
+	WildcardDNS               bool               `json:"wildcardDNS"`
+	Subdomains                []*SubdomainRecord `json:"subdomains"`
+	ZoneTransfers             []ZoneTransfer     `json:"zoneTransfers"`
+	Delegation                *Delegation        `json:"delegation"`
+	Sitemaps                  []*Sitemap         `json:"sitemaps"`
+	WebRedirectDomains        []*MatchedDomain   `json:"webRedirectDomains"`
+	WebRedirectChain          []RedirectHop      `json:"webRedirectChain"`
+	WebProbes                 []WebProbe         `json:"webProbes"`
+	CertSANs                  []*MatchedDomain   `json:"certSANs"`
+	SitemapWebDomains         []*MatchedDomain   `json:"sitemapWebDomains"`
+	SitemapContactDomains     []*MatchedDomain   `json:"sitemapContactDomains"`
+	ReverseWhoisDomains       []*MatchedDomain   `json:"reverseWhoisDomains"`
+	EmailPolicyDomains        []*MatchedDomain   `json:"emailPolicyDomains"`
+	PTRDomains                []*MatchedDomain   `json:"ptrDomains"`
+	CTDomains                 []*MatchedDomain   `json:"ctDomains"`
+	LandingPageDomains        []*MatchedDomain   `json:"landingPageDomains"`
+	OutboundLinkDomains       []*MatchedDomain   `json:"outboundLinkDomains"`
 
-	CertOrgNames []string   `json:"certOrgNames,omitempty"`
-	Whois        *WhoisData `json:"whoisData"`
+	CertOrgNames       []string            `json:"certOrgNames,omitempty"`
+	CTOrgNames         []string            `json:"ctOrgNames,omitempty"`
+	Certificate        *Certificate        `json:"certificate"`
+	JARM               string              `json:"jarm,omitempty"`
+	Whois              *WhoisData          `json:"whoisData"`
+	EmailSecurity      *EmailSecurity      `json:"emailSecurity"`
+	DNSSEC             *DNSSECStatus       `json:"dnssec"`
+	SiteClassification *SiteClassification `json:"siteClassification"`
+	LandingPage        *LandingPage        `json:"landingPage"`
 
 	sitemapURLs  []string
 	contactPages []string
+	landingURL   string
+	landingBody  []byte
+	// checkedEmailSecurity is set once EmailSecurity is filled in by this
+	// process rather than loaded from an earlier run
+	checkedEmailSecurity bool
 
 	*robotstxt.RobotsData
 }
@@ -74,24 +111,75 @@ func NewDomain(domainName string) (*Domain, error) {
 }
 
 type EnrichmentConfig struct {
-	CertSans         bool      `json:"cert_sans"`
-	DNS              bool      `json:"dns"`
-	Sitemap          bool      `json:"sitemap"`
-	WebRedirect      bool      `json:"web_redirect"`
-	Whois            bool      `json:"whois"`
-	ReverseWhois     bool      `json:"reverse_whois"`
-	MinFreshnessDate time.Time `json:"min_freshness_date"`
+	CertSans             bool      `json:"cert_sans"`
+	CertSANHosts         []string  `json:"cert_san_hosts"`
+	CertSANPorts         []string  `json:"cert_san_ports"`
+	CertSANSubdomains    bool      `json:"cert_san_subdomains"`
+	CertSANMX            bool      `json:"cert_san_mx"`
+	JARM                 bool      `json:"jarm"`
+	CTDomains            bool      `json:"ct_domains"`
+	DNS                  bool      `json:"dns"`
+	DNSSEC               bool      `json:"dnssec"`
+	CNAMEChains          bool      `json:"cname_chains"`
+	CNAMESubdomains      []string  `json:"cname_subdomains"`
+	SubdomainEnum        bool      `json:"subdomain_enum"`
+	SubdomainWordlist    []string  `json:"subdomain_wordlist"`
+	SubdomainConcurrency int       `json:"subdomain_concurrency"`
+	ZoneTransfer         bool      `json:"zone_transfer"`
+	Delegation           bool      `json:"delegation"`
+	Sitemap              bool      `json:"sitemap"`
+	WebRedirect          bool      `json:"web_redirect"`
+	OutboundLinks        bool      `json:"outbound_links"`
+	Whois                bool      `json:"whois"`
+	ReverseWhois         bool      `json:"reverse_whois"`
+	EmailSecurity        bool      `json:"email_security"`
+	EmailPolicyDomains   bool      `json:"email_policy_domains"`
+	PTRDomains           bool      `json:"ptr_domains"`
+	MinFreshnessDate     time.Time `json:"min_freshness_date"`
 }
 
 func (d *Domain) Enrich(cfg *EnrichmentConfig) {
 	if d.LastRanDns.Unix() <= cfg.MinFreshnessDate.Unix() && cfg.DNS {
 		d.GetDNSRecords()
+		if cfg.DNSSEC {
+			d.GetDNSSECStatus()
+		}
+		if cfg.CNAMEChains {
+			d.GetCNAMEChains(cfg.CNAMESubdomains)
+		}
+		if cfg.ZoneTransfer {
+			d.AttemptZoneTransfers()
+		}
+		if cfg.Delegation {
+			d.GetDelegation()
+		}
+	}
+	if d.LastRanPTRDomains.Unix() <= cfg.MinFreshnessDate.Unix() && cfg.PTRDomains {
+		d.GetPTRDomains()
+	}
+	if d.LastRanSubdomainEnum.Unix() <= cfg.MinFreshnessDate.Unix() && cfg.SubdomainEnum {
+		d.GetSubdomains(cfg.SubdomainWordlist, cfg.SubdomainConcurrency)
+	}
+	if d.LastRanEmailSecurity.Unix() <= cfg.MinFreshnessDate.Unix() && cfg.EmailSecurity {
+		d.GetEmailSecurity()
+	}
+	if d.LastRanEmailPolicyDomains.Unix() <= cfg.MinFreshnessDate.Unix() && cfg.EmailPolicyDomains {
+		d.GetEmailPolicyDomains()
 	}
 	if d.LastRanWebRedirect.Unix() <= cfg.MinFreshnessDate.Unix() && cfg.WebRedirect {
 		d.GetRedirectDomains()
 	}
+	if d.LastRanOutboundLinks.Unix() <= cfg.MinFreshnessDate.Unix() && cfg.OutboundLinks {
+		d.GetOutboundLinkDomains()
+	}
 	if d.LastRanCertSans.Unix() <= cfg.MinFreshnessDate.Unix() && cfg.CertSans {
-		d.GetCertSANs()
+		d.GetCertSANsFrom(d.CertProbes(cfg.CertSANHosts, cfg.CertSANPorts, cfg.CertSANSubdomains, cfg.CertSANMX))
+	}
+	if d.LastRanJARM.Unix() <= cfg.MinFreshnessDate.Unix() && cfg.JARM {
+		d.GetJARM()
+	}
+	if d.LastRanCTDomains.Unix() <= cfg.MinFreshnessDate.Unix() && cfg.CTDomains {
+		d.GetCTDomains()
 	}
 	if d.LastRanSitemapParse.Unix() <= cfg.MinFreshnessDate.Unix() && cfg.Sitemap {
 		d.GetDomainsFromSitemap()
@@ -110,6 +198,11 @@ type MatchedDomainsByStrategy struct {
 	SitemapWebDomains     []string `json:"sitemapWebDomains"`
 	SitemapContactDomains []string `json:"sitemapContactDomains"`
 	ReverseWhoisDomains   []string `json:"reverseWhoisDomains"`
+	EmailPolicyDomains    []string `json:"emailPolicyDomains"`
+	PTRDomains            []string `json:"ptrDomains"`
+	CTDomains             []string `json:"ctDomains"`
+	LandingPageDomains    []string `json:"landingPageDomains"`
+	OutboundLinkDomains   []string `json:"outboundLinkDomains"`
 }
 
 func (d *Domain) GetAllMatchedDomains() MatchedDomainsByStrategy {
@@ -129,5 +222,20 @@ func (d *Domain) GetAllMatchedDomains() MatchedDomainsByStrategy {
 	for _, c := range d.ReverseWhoisDomains {
 		allDomains.ReverseWhoisDomains = append(allDomains.ReverseWhoisDomains, c.DomainName)
 	}
+	for _, e := range d.EmailPolicyDomains {
+		allDomains.EmailPolicyDomains = append(allDomains.EmailPolicyDomains, e.DomainName)
+	}
+	for _, p := range d.PTRDomains {
+		allDomains.PTRDomains = append(allDomains.PTRDomains, p.DomainName)
+	}
+	for _, c := range d.CTDomains {
+		allDomains.CTDomains = append(allDomains.CTDomains, c.DomainName)
+	}
+	for _, l := range d.LandingPageDomains {
+		allDomains.LandingPageDomains = append(allDomains.LandingPageDomains, l.DomainName)
+	}
+	for _, o := range d.OutboundLinkDomains {
+		allDomains.OutboundLinkDomains = append(allDomains.OutboundLinkDomains, o.DomainName)
+	}
 	return allDomains
 }
@@ -0,0 +1,563 @@
+package domain
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// spfLookupLimit is the maximum number of DNS-querying terms allowed while
+// evaluating an SPF record (RFC 7208 section 4.6.4).
+const spfLookupLimit = 10
+
+// dkimSelectors are the selectors probed for DKIM keys, since selectors
+// cannot be enumerated from DNS.
+var dkimSelectors = []string{
+	"default",
+	"dkim",
+	"mail",
+	"google",
+	"selector1",
+	"selector2",
+	"k1",
+	"k2",
+	"s1",
+	"s2",
+	"smtp",
+	"mandrill",
+	"mxvault",
+	"zoho",
+	"fm1",
+	"fm2",
+	"protonmail",
+	"everlytickey1",
+}
+
+type SPFPolicy struct {
+	Record          string   `json:"record"`
+	Mechanisms      []string `json:"mechanisms,omitempty"`
+	All             string   `json:"all,omitempty"`
+	Includes        []string `json:"includes,omitempty"`
+	Redirect        string   `json:"redirect,omitempty"`
+	IncludedDomains []string `json:"includedDomains,omitempty"`
+	DNSLookups      int      `json:"dnsLookups"`
+}
+
+type DMARCPolicy struct {
+	Record          string   `json:"record"`
+	Policy          string   `json:"policy,omitempty"`
+	SubdomainPolicy string   `json:"subdomainPolicy,omitempty"`
+	Percent         int      `json:"percent"`
+	AlignDKIM       string   `json:"alignDKIM,omitempty"`
+	AlignSPF        string   `json:"alignSPF,omitempty"`
+	RUA             []string `json:"rua,omitempty"`
+	RUF             []string `json:"ruf,omitempty"`
+}
+
+type DKIMRecord struct {
+	Selector string `json:"selector"`
+	Record   string `json:"record"`
+	KeyType  string `json:"keyType,omitempty"`
+	KeyBits  int    `json:"keyBits,omitempty"`
+	Revoked  bool   `json:"revoked,omitempty"`
+}
+
+type MTASTSPolicy struct {
+	Record string   `json:"record"`
+	ID     string   `json:"id,omitempty"`
+	Mode   string   `json:"mode,omitempty"`
+	MX     []string `json:"mx,omitempty"`
+	MaxAge int      `json:"maxAge,omitempty"`
+}
+
+type TLSRPTPolicy struct {
+	Record string   `json:"record"`
+	RUA    []string `json:"rua,omitempty"`
+}
+
+type EmailSecurity struct {
+	SPF               *SPFPolicy    `json:"spf"`
+	DMARC             *DMARCPolicy  `json:"dmarc"`
+	DKIM              []DKIMRecord  `json:"dkim"`
+	MTASTS            *MTASTSPolicy `json:"mtaSts"`
+	TLSRPT            *TLSRPTPolicy `json:"tlsRpt"`
+	Problems          []string      `json:"problems"`
+	ReferencedDomains []string      `json:"referencedDomains"`
+}
+
+func (e *EmailSecurity) addProblem(format string, args ...interface{}) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, args...))
+}
+
+func (d *Domain) GetEmailSecurity() error {
+	d.LastRanEmailSecurity = time.Now()
+	if d.NonPublicDomain {
+		return errors.New("Non public domain")
+	}
+	es := &EmailSecurity{}
+	d.checkSPF(es)
+	d.checkDMARC(es)
+	d.checkDKIM(es)
+	d.checkMTASTS(es)
+	d.checkTLSRPT(es)
+	es.ReferencedDomains = d.emailReferencedDomains(es)
+	d.EmailSecurity = es
+	d.checkedEmailSecurity = true
+	return nil
+}
+
+func recordsWithPrefix(records []string, prefix string) []string {
+	var matched []string
+	for _, r := range records {
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(r)), strings.ToLower(prefix)) {
+			matched = append(matched, strings.TrimSpace(r))
+		}
+	}
+	return matched
+}
+
+// parseTags splits a "k=v; k=v" style record as used by DMARC, DKIM,
+// MTA-STS and TLS-RPT.
+func parseTags(record string) map[string]string {
+	tags := make(map[string]string)
+	for _, part := range strings.Split(record, ";") {
+		k, v, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		tags[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+	}
+	return tags
+}
+
+func parseSPF(record string) *SPFPolicy {
+	p := &SPFPolicy{Record: record}
+	terms := strings.Fields(strings.ToLower(record))
+	for _, term := range terms[1:] {
+		if target, ok := strings.CutPrefix(term, "redirect="); ok {
+			p.Redirect = target
+			continue
+		}
+		if strings.HasPrefix(term, "exp=") {
+			continue
+		}
+		p.Mechanisms = append(p.Mechanisms, term)
+		mech := strings.TrimLeft(term, "+-~?")
+		switch {
+		case mech == "all":
+			p.All = term
+			if term == "all" {
+				p.All = "+all"
+			}
+		case strings.HasPrefix(mech, "include:"):
+			p.Includes = append(p.Includes, strings.TrimPrefix(mech, "include:"))
+		}
+	}
+	return p
+}
+
+// lookupTerms counts the terms of the record that cost a DNS lookup.
+func (p *SPFPolicy) lookupTerms() int {
+	n := 0
+	for _, term := range p.Mechanisms {
+		mech := strings.TrimLeft(term, "+-~?")
+		name, _, _ := strings.Cut(mech, ":")
+		name, _, _ = strings.Cut(name, "/")
+		switch name {
+		case "include", "a", "mx", "ptr", "exists":
+			n++
+		}
+	}
+	if p.Redirect != "" && p.All == "" {
+		n++
+	}
+	return n
+}
+
+type spfWalker struct {
+	lookups  int
+	visited  map[string]bool
+	domains  []string
+	problems []string
+}
+
+func (w *spfWalker) walk(p *SPFPolicy) {
+	w.lookups += p.lookupTerms()
+	targets := append([]string{}, p.Includes...)
+	if p.Redirect != "" && p.All == "" {
+		targets = append(targets, p.Redirect)
+	}
+	for _, target := range targets {
+		if w.lookups > spfLookupLimit {
+			return
+		}
+		if strings.Contains(target, "%") {
+			continue
+		}
+		if w.visited[target] {
+			w.problems = append(w.problems, fmt.Sprintf("SPF record for %s is referenced more than once", target))
+			continue
+		}
+		w.visited[target] = true
+		w.domains = append(w.domains, target)
+		records, err := lookupTXT(target)
+		if err != nil {
+			w.problems = append(w.problems, fmt.Sprintf("SPF lookup for %s failed: %v", target, err))
+			continue
+		}
+		spfs := recordsWithPrefix(records, "v=spf1")
+		if len(spfs) == 0 {
+			w.problems = append(w.problems, fmt.Sprintf("SPF reference %s has no SPF record", target))
+			continue
+		}
+		w.walk(parseSPF(spfs[0]))
+	}
+}
+
+func (d *Domain) checkSPF(es *EmailSecurity) {
+	records, err := lookupTXT(d.DomainName)
+	if err != nil {
+		es.addProblem("SPF lookup failed: %v", err)
+		return
+	}
+	spfs := recordsWithPrefix(records, "v=spf1")
+	if len(spfs) == 0 {
+		es.addProblem("no SPF record published")
+		return
+	}
+	if len(spfs) > 1 {
+		es.addProblem("%d SPF records published, only one is allowed", len(spfs))
+	}
+	spf := parseSPF(spfs[0])
+	w := &spfWalker{visited: map[string]bool{strings.ToLower(d.DomainName): true}}
+	w.walk(spf)
+	spf.DNSLookups = w.lookups
+	spf.IncludedDomains = w.domains
+	es.SPF = spf
+	es.Problems = append(es.Problems, w.problems...)
+	if w.lookups > spfLookupLimit {
+		es.addProblem("SPF record needs more than %d DNS lookups", spfLookupLimit)
+	}
+	switch spf.All {
+	case "+all":
+		es.addProblem("SPF record allows any sender with +all")
+	case "?all":
+		es.addProblem("SPF record is neutral with ?all")
+	case "":
+		if spf.Redirect == "" {
+			es.addProblem("SPF record has no all mechanism")
+		}
+	}
+	for _, m := range spf.Mechanisms {
+		if strings.HasPrefix(strings.TrimLeft(m, "+-~?"), "ptr") {
+			es.addProblem("SPF record uses the deprecated ptr mechanism")
+			break
+		}
+	}
+}
+
+func (d *Domain) checkDMARC(es *EmailSecurity) {
+	records, err := lookupTXT("_dmarc." + d.DomainName)
+	if err != nil {
+		es.addProblem("DMARC lookup failed: %v", err)
+		return
+	}
+	dmarcs := recordsWithPrefix(records, "v=DMARC1")
+	if len(dmarcs) == 0 {
+		es.addProblem("no DMARC record published")
+		return
+	}
+	if len(dmarcs) > 1 {
+		es.addProblem("%d DMARC records published, only one is allowed", len(dmarcs))
+	}
+	tags := parseTags(dmarcs[0])
+	dmarc := &DMARCPolicy{
+		Record:          dmarcs[0],
+		Policy:          strings.ToLower(tags["p"]),
+		SubdomainPolicy: strings.ToLower(tags["sp"]),
+		Percent:         100,
+		AlignDKIM:       strings.ToLower(tags["adkim"]),
+		AlignSPF:        strings.ToLower(tags["aspf"]),
+		RUA:             splitReportURIs(tags["rua"]),
+		RUF:             splitReportURIs(tags["ruf"]),
+	}
+	if pct, ok := tags["pct"]; ok {
+		n, err := strconv.Atoi(pct)
+		if err != nil || n < 0 || n > 100 {
+			es.addProblem("DMARC pct value '%s' is invalid", pct)
+		} else {
+			dmarc.Percent = n
+		}
+	}
+	es.DMARC = dmarc
+	switch dmarc.Policy {
+	case "reject", "quarantine":
+	case "none":
+		es.addProblem("DMARC policy is none, failing mail is not rejected")
+	case "":
+		es.addProblem("DMARC record has no p tag")
+	default:
+		es.addProblem("DMARC policy '%s' is invalid", dmarc.Policy)
+	}
+	if dmarc.Percent < 100 {
+		es.addProblem("DMARC policy only applies to %d%% of mail", dmarc.Percent)
+	}
+	if len(dmarc.RUA) == 0 {
+		es.addProblem("DMARC record has no aggregate report address")
+	}
+}
+
+func splitReportURIs(value string) []string {
+	var uris []string
+	for _, u := range strings.Split(value, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			uris = append(uris, u)
+		}
+	}
+	return uris
+}
+
+// reportURIDomain returns the host a DMARC or TLS-RPT report URI sends to.
+func reportURIDomain(uri string) string {
+	if addr, ok := strings.CutPrefix(strings.ToLower(uri), "mailto:"); ok {
+		addr, _, _ = strings.Cut(addr, "!")
+		_, host, _ := strings.Cut(addr, "@")
+		return host
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+func (d *Domain) checkDKIM(es *EmailSecurity) {
+	for _, selector := range dkimSelectors {
+		records, err := lookupTXT(selector + "._domainkey." + d.DomainName)
+		if err != nil {
+			continue
+		}
+		for _, record := range records {
+			tags := parseTags(record)
+			if _, ok := tags["p"]; !ok {
+				continue
+			}
+			es.DKIM = append(es.DKIM, parseDKIM(selector, record, tags, es))
+		}
+	}
+	if len(es.DKIM) == 0 {
+		es.addProblem("no DKIM key found for common selectors")
+	}
+}
+
+func parseDKIM(selector, record string, tags map[string]string, es *EmailSecurity) DKIMRecord {
+	dk := DKIMRecord{Selector: selector, Record: record, KeyType: strings.ToLower(tags["k"])}
+	if dk.KeyType == "" {
+		dk.KeyType = "rsa"
+	}
+	p := strings.Join(strings.Fields(tags["p"]), "")
+	if p == "" {
+		dk.Revoked = true
+		return dk
+	}
+	raw, err := base64.StdEncoding.DecodeString(p)
+	if err != nil {
+		es.addProblem("DKIM key for selector %s is not valid base64", selector)
+		return dk
+	}
+	if dk.KeyType == "ed25519" {
+		dk.KeyBits = len(raw) * 8
+		return dk
+	}
+	key, err := x509.ParsePKIXPublicKey(raw)
+	if err != nil {
+		es.addProblem("DKIM key for selector %s could not be parsed", selector)
+		return dk
+	}
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		dk.KeyBits = k.N.BitLen()
+		if dk.KeyBits < 1024 {
+			es.addProblem("DKIM key for selector %s is only %d bits", selector, dk.KeyBits)
+		}
+	case ed25519.PublicKey:
+		dk.KeyBits = len(k) * 8
+	}
+	return dk
+}
+
+func (d *Domain) checkMTASTS(es *EmailSecurity) {
+	records, err := lookupTXT("_mta-sts." + d.DomainName)
+	if err != nil {
+		return
+	}
+	stss := recordsWithPrefix(records, "v=STSv1")
+	if len(stss) == 0 {
+		return
+	}
+	policy := &MTASTSPolicy{Record: stss[0], ID: parseTags(stss[0])["id"]}
+	es.MTASTS = policy
+	if err := policy.fetch(d.DomainName); err != nil {
+		es.addProblem("MTA-STS policy could not be fetched: %v", err)
+		return
+	}
+	switch policy.Mode {
+	case "enforce":
+	case "testing":
+		es.addProblem("MTA-STS policy is in testing mode")
+	case "none":
+		es.addProblem("MTA-STS policy mode is none")
+	default:
+		es.addProblem("MTA-STS policy mode '%s' is invalid", policy.Mode)
+	}
+}
+
+// fetch downloads the policy. RFC 8461 section 3.3 forbids following
+// redirects when fetching it, so a redirect is reported as an error.
+func (p *MTASTSPolicy) fetch(domainName string) error {
+	noRedirects := *client.HTTP
+	noRedirects.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := noRedirects.Get(fmt.Sprintf("https://mta-sts.%s/.well-known/mta-sts.txt", domainName))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		return fmt.Errorf("redirected to %s with status code %d, which MTA-STS does not allow", resp.Header.Get("Location"), resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("received status code %d", resp.StatusCode)
+	}
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, 64*1024))
+	for scanner.Scan() {
+		k, v, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		switch strings.ToLower(strings.TrimSpace(k)) {
+		case "mode":
+			p.Mode = strings.ToLower(v)
+		case "mx":
+			p.MX = append(p.MX, strings.ToLower(v))
+		case "max_age":
+			p.MaxAge, _ = strconv.Atoi(v)
+		}
+	}
+	return scanner.Err()
+}
+
+func (d *Domain) checkTLSRPT(es *EmailSecurity) {
+	records, err := lookupTXT("_smtp._tls." + d.DomainName)
+	if err != nil {
+		return
+	}
+	rpts := recordsWithPrefix(records, "v=TLSRPTv1")
+	if len(rpts) == 0 {
+		return
+	}
+	es.TLSRPT = &TLSRPTPolicy{Record: rpts[0], RUA: splitReportURIs(parseTags(rpts[0])["rua"])}
+	if len(es.TLSRPT.RUA) == 0 {
+		es.addProblem("TLS-RPT record has no report address")
+	}
+}
+
+func (d *Domain) emailReferencedDomains(es *EmailSecurity) []string {
+	hosts := spfDMARCHosts(es)
+	if es.TLSRPT != nil {
+		for _, uri := range es.TLSRPT.RUA {
+			hosts = append(hosts, reportURIDomain(uri))
+		}
+	}
+	if es.MTASTS != nil {
+		for _, mx := range es.MTASTS.MX {
+			hosts = append(hosts, strings.TrimPrefix(mx, "*."))
+		}
+	}
+	return d.registrableDomains(hosts)
+}
+
+// spfDMARCHosts returns the hosts named in SPF include/redirect terms and
+// DMARC report addresses.
+func spfDMARCHosts(es *EmailSecurity) []string {
+	var hosts []string
+	if es.SPF != nil {
+		hosts = append(hosts, es.SPF.IncludedDomains...)
+	}
+	if es.DMARC != nil {
+		for _, uri := range append(append([]string{}, es.DMARC.RUA...), es.DMARC.RUF...) {
+			hosts = append(hosts, reportURIDomain(uri))
+		}
+	}
+	return hosts
+}
+
+// registrableDomains reduces hosts to unique registrable domains other than
+// the domain itself.
+func (d *Domain) registrableDomains(hosts []string) []string {
+	found := make(map[string]bool)
+	for _, h := range hosts {
+		if h == "" {
+			continue
+		}
+		dom, err := NewDomain(strings.TrimSuffix(h, "."))
+		if err != nil || dom.DomainName == d.DomainName {
+			continue
+		}
+		found[dom.DomainName] = true
+	}
+	doms := make([]string, 0, len(found))
+	for dom := range found {
+		doms = append(doms, dom)
+	}
+	sort.Strings(doms)
+	return doms
+}
+
+// GetEmailPolicyDomains collects the domains named in SPF include/redirect
+// terms and DMARC report addresses, which often belong to the same owner.
+// The SPF and DMARC results of GetEmailSecurity are reused when it ran first.
+func (d *Domain) GetEmailPolicyDomains() error {
+	d.LastRanEmailPolicyDomains = time.Now()
+	if d.NonPublicDomain {
+		return errors.New("Non public domain")
+	}
+	es := d.EmailSecurity
+	if !d.checkedEmailSecurity || es == nil {
+		es = &EmailSecurity{}
+		d.checkSPF(es)
+		d.checkDMARC(es)
+	}
+	hosts := spfDMARCHosts(es)
+	domsFound := make(map[string]*MatchedDomain)
+	for _, df := range d.EmailPolicyDomains {
+		domsFound[df.DomainName] = df
+	}
+	now := time.Now()
+	for _, dom := range d.registrableDomains(hosts) {
+		if df, exists := domsFound[dom]; !exists {
+			domsFound[dom] = &MatchedDomain{CreatedAt: now, UpdatedAt: now, DomainName: dom}
+		} else {
+			df.UpdatedAt = now
+		}
+	}
+	var epd []*MatchedDomain
+	for _, df := range domsFound {
+		epd = append(epd, df)
+	}
+	d.EmailPolicyDomains = epd
+	return nil
+}
@@ -0,0 +1,101 @@
+package domain
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetEmailSecurity(t *testing.T) {
+	addr := startTestDNSServer(t, answerHandler(
+		`example.com. 300 IN TXT "v=spf1 include:_spf.example.net mx -all"`,
+		`_spf.example.net. 300 IN TXT "v=spf1 include:_spf.example.org ~all"`,
+		`_spf.example.org. 300 IN TXT "v=spf1 ip4:192.0.2.0/24 -all"`,
+		`_dmarc.example.com. 300 IN TXT "v=DMARC1; p=none; pct=50; rua=mailto:reports@dmarc.example.io!10m"`,
+	))
+	useTestResolvers(t, addr)
+
+	d := &Domain{DomainName: "example.com"}
+	if err := d.GetEmailSecurity(); err != nil {
+		t.Fatal(err)
+	}
+	es := d.EmailSecurity
+	if es.SPF == nil || es.SPF.All != "-all" {
+		t.Fatalf("unexpected SPF policy: %+v", es.SPF)
+	}
+	if es.SPF.DNSLookups != 3 {
+		t.Fatalf("expected 3 SPF lookups, got %d", es.SPF.DNSLookups)
+	}
+	if es.DMARC == nil || es.DMARC.Policy != "none" || es.DMARC.Percent != 50 {
+		t.Fatalf("unexpected DMARC policy: %+v", es.DMARC)
+	}
+	expected := "example.io example.net example.org"
+	if got := strings.Join(es.ReferencedDomains, " "); got != expected {
+		t.Fatalf("expected referenced domains %s, got %s", expected, got)
+	}
+	for _, problem := range []string{"DMARC policy is none", "no DKIM key found"} {
+		found := false
+		for _, p := range es.Problems {
+			if strings.Contains(p, problem) {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("expected problem %q in %v", problem, es.Problems)
+		}
+	}
+}
+
+func TestGetEmailPolicyDomains(t *testing.T) {
+	addr := startTestDNSServer(t, answerHandler(
+		`example.com. 300 IN TXT "v=spf1 redirect=_spf.example.net"`,
+		`_spf.example.net. 300 IN TXT "v=spf1 -all"`,
+		`_dmarc.example.com. 300 IN TXT "v=DMARC1; p=reject; rua=mailto:a@example.com; ruf=mailto:f@example.org"`,
+	))
+	useTestResolvers(t, addr)
+
+	d := &Domain{DomainName: "example.com"}
+	if err := d.GetEmailPolicyDomains(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(d.GetAllMatchedDomains().EmailPolicyDomains); n != 2 {
+		t.Fatalf("expected 2 email policy domains, got %d", n)
+	}
+}
+
+func TestGetEmailPolicyDomainsReusesEmailSecurity(t *testing.T) {
+	addr := startTestDNSServer(t, answerHandler())
+	useTestResolvers(t, addr)
+
+	d := &Domain{DomainName: "example.com", EmailSecurity: &EmailSecurity{SPF: &SPFPolicy{IncludedDomains: []string{"_spf.example.net"}}}}
+	d.checkedEmailSecurity = true
+	if err := d.GetEmailPolicyDomains(); err != nil {
+		t.Fatal(err)
+	}
+	if got := d.GetAllMatchedDomains().EmailPolicyDomains; len(got) != 1 || got[0] != "example.net" {
+		t.Fatalf("expected example.net from the existing SPF result, got %v", got)
+	}
+}
+
+func TestMTASTSPolicyFetchRejectsRedirect(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://policy.example.net/mta-sts.txt", http.StatusMovedPermanently)
+	}))
+	defer srv.Close()
+	prev := client.HTTP
+	client.HTTP = srv.Client()
+	client.HTTP.Transport.(*http.Transport).DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return net.Dial(network, srv.Listener.Addr().String())
+	}
+	client.HTTP.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify = true
+	t.Cleanup(func() { client.HTTP = prev })
+
+	p := &MTASTSPolicy{}
+	err := p.fetch("example.com")
+	if err == nil || !strings.Contains(err.Error(), "redirected") {
+		t.Fatalf("expected the redirect to be reported, got %v", err)
+	}
+}
@@ -5,7 +5,10 @@ import (
 )
 
 type MatchedDomain struct {
-	CreatedAt  time.Time `json:"createdAt,omitempty"`
-	UpdatedAt  time.Time `json:"updatedAt,omitempty"`
-	DomainName string    `json:"matchedDomain,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt,omitempty"`
+	UpdatedAt  time.Time  `json:"updatedAt,omitempty"`
+	DomainName string     `json:"matchedDomain,omitempty"`
+	Sources    []string   `json:"sources,omitempty"`
+	FirstSeen  *time.Time `json:"firstSeen,omitempty"`
+	LastSeen   *time.Time `json:"lastSeen,omitempty"`
 }
@@ -0,0 +1,245 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	maxReferrals    = 16
+	maxIterateDepth = 4
+)
+
+// rootHints are the IPv4 addresses of the IANA root servers a-m.
+var rootHints = []string{
+	"198.41.0.4",
+	"170.247.170.2",
+	"192.33.4.12",
+	"199.7.91.13",
+	"192.203.230.10",
+	"192.5.5.241",
+	"192.112.36.4",
+	"198.97.190.53",
+	"192.36.148.17",
+	"192.58.128.30",
+	"193.0.14.129",
+	"199.7.83.42",
+	"202.12.27.33",
+}
+
+// DelegationStep is one referral on the way from the root to a domain's
+// authoritative servers.
+type DelegationStep struct {
+	Zone   string   `json:"zone"`
+	Server string   `json:"server"`
+	NS     []string `json:"ns"`
+	Glue   []string `json:"glue,omitempty"`
+}
+
+type Delegation struct {
+	Path       []DelegationStep `json:"path"`
+	ParentNS   []string         `json:"parentNS"`
+	ChildNS    []string         `json:"childNS"`
+	NSMismatch bool             `json:"nsMismatch"`
+}
+
+// IterativeResolver resolves names itself by following referrals from the
+// root servers, so answers come straight from the authoritative servers
+// instead of a recursive resolver's cache. Port is used for every server
+// learned from a referral.
+type IterativeResolver struct {
+	RootHints []string
+	Port      string
+}
+
+func NewIterativeResolver() *IterativeResolver {
+	hints := make([]string, len(rootHints))
+	for i, h := range rootHints {
+		hints[i] = net.JoinHostPort(h, "53")
+	}
+	return &IterativeResolver{RootHints: hints, Port: "53"}
+}
+
+func (r *IterativeResolver) Exchange(msg *dns.Msg) (*dns.Msg, error) {
+	resp, _, err := r.resolve(msg, 0)
+	return resp, err
+}
+
+func (r *IterativeResolver) String() string {
+	return "iterative"
+}
+
+// resolve walks from the root hints to an authoritative answer for msg,
+// following CNAMEs that leave the zone, and returns the referrals taken.
+func (r *IterativeResolver) resolve(msg *dns.Msg, depth int) (*dns.Msg, []DelegationStep, error) {
+	if depth > maxIterateDepth {
+		return nil, nil, errors.New("iterative resolution nested too deeply")
+	}
+	resp, path, err := r.walk(msg, depth)
+	if err != nil || resp.Rcode != dns.RcodeSuccess {
+		return resp, path, err
+	}
+	q := msg.Question[0]
+	if q.Qtype == dns.TypeCNAME {
+		return resp, path, nil
+	}
+	name := q.Name
+	for hops := 0; hops < maxCNAMEChain; hops++ {
+		target := ""
+		for _, rr := range resp.Answer {
+			if strings.EqualFold(rr.Header().Name, name) {
+				if rr.Header().Rrtype == q.Qtype {
+					return resp, path, nil
+				}
+				if c, ok := rr.(*dns.CNAME); ok {
+					target = c.Target
+				}
+			}
+		}
+		if target == "" {
+			return resp, path, nil
+		}
+		next := new(dns.Msg)
+		next.SetQuestion(target, q.Qtype)
+		chased, _, err := r.walk(next, depth)
+		if err != nil {
+			return nil, path, err
+		}
+		resp.Answer = append(resp.Answer, chased.Answer...)
+		resp.Rcode = chased.Rcode
+		name = target
+	}
+	return resp, path, nil
+}
+
+func (r *IterativeResolver) walk(msg *dns.Msg, depth int) (*dns.Msg, []DelegationStep, error) {
+	servers := r.RootHints
+	zone := "."
+	var path []DelegationStep
+	for i := 0; i < maxReferrals; i++ {
+		q := msg.Copy()
+		q.RecursionDesired = false
+		resp, server, err := exchangeAny(q, servers)
+		if err != nil {
+			return nil, path, err
+		}
+		if resp.Authoritative || len(resp.Answer) > 0 || resp.Rcode != dns.RcodeSuccess {
+			return resp, path, nil
+		}
+		step := DelegationStep{Server: server}
+		for _, rr := range resp.Ns {
+			if ns, ok := rr.(*dns.NS); ok {
+				step.Zone = dns.CanonicalName(ns.Hdr.Name)
+				step.NS = append(step.NS, dns.CanonicalName(ns.Ns))
+			}
+		}
+		if len(step.NS) == 0 {
+			return resp, path, nil
+		}
+		if step.Zone == zone || !dns.IsSubDomain(zone, step.Zone) {
+			return nil, path, fmt.Errorf("bad referral from %s to %s", server, step.Zone)
+		}
+		var next []string
+		for _, rr := range resp.Extra {
+			var ip string
+			switch a := rr.(type) {
+			case *dns.A:
+				ip = a.A.String()
+			case *dns.AAAA:
+				ip = a.AAAA.String()
+			default:
+				continue
+			}
+			if slices.Contains(step.NS, dns.CanonicalName(rr.Header().Name)) {
+				step.Glue = append(step.Glue, fmt.Sprintf("%s %s", dns.CanonicalName(rr.Header().Name), ip))
+				next = append(next, net.JoinHostPort(ip, r.Port))
+			}
+		}
+		if len(next) == 0 {
+			next = r.resolveNameservers(step.NS, depth)
+		}
+		if len(next) == 0 {
+			return nil, path, fmt.Errorf("unable to resolve any nameserver for %s", step.Zone)
+		}
+		path = append(path, step)
+		zone = step.Zone
+		servers = next
+	}
+	return nil, path, errors.New("too many referrals")
+}
+
+// resolveNameservers finds addresses for out-of-bailiwick nameservers that
+// came without glue.
+func (r *IterativeResolver) resolveNameservers(names []string, depth int) []string {
+	var addrs []string
+	for _, name := range names {
+		msg := new(dns.Msg)
+		msg.SetQuestion(name, dns.TypeA)
+		resp, _, err := r.resolve(msg, depth+1)
+		if err != nil {
+			continue
+		}
+		for _, rr := range resp.Answer {
+			if a, ok := rr.(*dns.A); ok {
+				addrs = append(addrs, net.JoinHostPort(a.A.String(), r.Port))
+			}
+		}
+		if len(addrs) > 0 {
+			return addrs
+		}
+	}
+	return addrs
+}
+
+// exchangeAny tries servers in order until one gives a usable response.
+func exchangeAny(msg *dns.Msg, servers []string) (*dns.Msg, string, error) {
+	var errs []*ResolverError
+	for _, s := range servers {
+		resp, err := query(msg, s)
+		if err == nil && resp.Rcode != dns.RcodeServerFailure && resp.Rcode != dns.RcodeRefused {
+			return resp, s, nil
+		}
+		if err == nil {
+			err = &RcodeError{Rcode: resp.Rcode}
+		}
+		errs = append(errs, &ResolverError{Resolver: s, Err: err})
+	}
+	return nil, "", &ResolverPoolError{Errors: errs}
+}
+
+// GetDelegation resolves the domain's NS records iteratively from the root,
+// recording each referral and comparing the NS set published by the parent
+// zone with the one served by the domain's own nameservers.
+func (d *Domain) GetDelegation() error {
+	if d.NonPublicDomain {
+		return errors.New("Non public domain")
+	}
+	name := dns.Fqdn(strings.ToLower(d.DomainName))
+	msg := new(dns.Msg)
+	msg.SetQuestion(name, dns.TypeNS)
+	resp, path, err := client.Iterative.resolve(msg, 0)
+	if err != nil {
+		return err
+	}
+	del := &Delegation{Path: path}
+	for _, step := range path {
+		if step.Zone == name {
+			del.ParentNS = slices.Clone(step.NS)
+		}
+	}
+	for _, rr := range resp.Answer {
+		if ns, ok := rr.(*dns.NS); ok {
+			del.ChildNS = append(del.ChildNS, dns.CanonicalName(ns.Ns))
+		}
+	}
+	slices.Sort(del.ParentNS)
+	slices.Sort(del.ChildNS)
+	del.NSMismatch = len(del.ParentNS) > 0 && !slices.Equal(del.ParentNS, del.ChildNS)
+	d.Delegation = del
+	return nil
+}
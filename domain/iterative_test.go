@@ -0,0 +1,79 @@
+package domain
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func referralHandler(zone string, ns map[string]string) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		if !dns.IsSubDomain(zone, req.Question[0].Name) {
+			m.Rcode = dns.RcodeRefused
+			w.WriteMsg(m)
+			return
+		}
+		for name, ip := range ns {
+			nsRR, _ := dns.NewRR(zone + " 3600 IN NS " + name)
+			glue, _ := dns.NewRR(name + " 3600 IN A " + ip)
+			m.Ns = append(m.Ns, nsRR)
+			m.Extra = append(m.Extra, glue)
+		}
+		w.WriteMsg(m)
+	}
+}
+
+func TestGetDelegation(t *testing.T) {
+	root := startTestDNSServer(t, referralHandler("com.", map[string]string{"a.gtld.test.": "127.0.0.2"}))
+	_, port, _ := net.SplitHostPort(root)
+	pc, err := net.ListenPacket("udp", net.JoinHostPort("127.0.0.2", port))
+	if err != nil {
+		t.Skipf("unable to listen on 127.0.0.2: %s", err.Error())
+	}
+	pc.Close()
+	startTestDNSServerAt(t, net.JoinHostPort("127.0.0.2", port), referralHandler("example.com.", map[string]string{
+		"ns1.example.com.": "127.0.0.3",
+		"ns2.example.com.": "127.0.0.3",
+	}))
+	startTestDNSServerAt(t, net.JoinHostPort("127.0.0.3", port), func(w dns.ResponseWriter, req *dns.Msg) {
+		m := answerFor(req,
+			"example.com. 3600 IN NS ns1.example.com.",
+			"example.com. 3600 IN NS ns3.example.com.",
+			"www.example.com. 3600 IN A 192.0.2.1",
+		)
+		m.Authoritative = true
+		w.WriteMsg(m)
+	})
+	prev := client.Iterative
+	client.Iterative = &IterativeResolver{RootHints: []string{root}, Port: port}
+	t.Cleanup(func() { client.Iterative = prev })
+
+	d := &Domain{DomainName: "example.com"}
+	if err := d.GetDelegation(); err != nil {
+		t.Fatal(err)
+	}
+	del := d.Delegation
+	if len(del.Path) != 2 || del.Path[0].Zone != "com." || del.Path[1].Zone != "example.com." {
+		t.Fatalf("unexpected delegation path: %+v", del.Path)
+	}
+	if !del.NSMismatch {
+		t.Fatalf("expected NS mismatch between %v and %v", del.ParentNS, del.ChildNS)
+	}
+	if got := strings.Join(del.ChildNS, " "); got != "ns1.example.com. ns3.example.com." {
+		t.Fatalf("unexpected child NS: %s", got)
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("www.example.com.", dns.TypeA)
+	r, err := client.Iterative.Exchange(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Answer) != 1 || !r.Authoritative {
+		t.Fatalf("expected an authoritative answer, got %v", r)
+	}
+}
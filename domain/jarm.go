@@ -0,0 +1,402 @@
+package domain
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// jarmProbe describes one of the ClientHellos JARM sends. The fields match
+// the probe definitions of the reference implementation.
+type jarmProbe struct {
+	version     uint16
+	noTLS13     bool
+	cipherOrder string
+	grease      bool
+	rareALPN    bool
+	support     string
+	extOrder    string
+}
+
+const (
+	jarmForward    = "FORWARD"
+	jarmReverse    = "REVERSE"
+	jarmTopHalf    = "TOP_HALF"
+	jarmBottomHalf = "BOTTOM_HALF"
+	jarmMiddleOut  = "MIDDLE_OUT"
+)
+
+var jarmProbes = []jarmProbe{
+	{version: 0x0303, cipherOrder: jarmForward, support: "1.2", extOrder: jarmReverse},
+	{version: 0x0303, cipherOrder: jarmReverse, support: "1.2", extOrder: jarmForward},
+	{version: 0x0303, cipherOrder: jarmTopHalf, extOrder: jarmForward},
+	{version: 0x0303, cipherOrder: jarmBottomHalf, rareALPN: true, extOrder: jarmForward},
+	{version: 0x0303, cipherOrder: jarmMiddleOut, grease: true, rareALPN: true, extOrder: jarmReverse},
+	{version: 0x0302, cipherOrder: jarmForward, extOrder: jarmForward},
+	{version: 0x0304, cipherOrder: jarmForward, support: "1.3", extOrder: jarmReverse},
+	{version: 0x0304, cipherOrder: jarmReverse, support: "1.3", extOrder: jarmForward},
+	{version: 0x0304, noTLS13: true, cipherOrder: jarmForward, support: "1.3", extOrder: jarmForward},
+	{version: 0x0304, cipherOrder: jarmMiddleOut, grease: true, support: "1.3", extOrder: jarmReverse},
+}
+
+// jarmCiphers is the cipher suite list offered by every probe, before it
+// is reordered.
+var jarmCiphers = []uint16{
+	0x0016, 0x0033, 0x0067, 0xc09e, 0xc0a2, 0x009e, 0x0039, 0x006b, 0xc09f, 0xc0a3,
+	0x009f, 0x0045, 0x00be, 0x0088, 0x00c4, 0x009a, 0xc008, 0xc009, 0xc023, 0xc0ac,
+	0xc0ae, 0xc02b, 0xc00a, 0xc024, 0xc0ad, 0xc0af, 0xc02c, 0xc072, 0xc073, 0xcca9,
+	0x1302, 0x1301, 0xcc14, 0xc007, 0xc012, 0xc013, 0xc027, 0xc02f, 0xc014, 0xc028,
+	0xc030, 0xc060, 0xc061, 0xc076, 0xc077, 0xcca8, 0x1305, 0x1304, 0x1303, 0xcc13,
+	0xc011, 0x000a, 0x002f, 0x003c, 0xc09c, 0xc0a0, 0x009c, 0x0035, 0x003d, 0xc09d,
+	0xc0a1, 0x009d, 0x0041, 0x00ba, 0x0084, 0x00c0, 0x0007, 0x0004, 0x0005,
+}
+
+// jarmCipherIndex is the sorted cipher list used to encode the selected
+// cipher in the fingerprint.
+var jarmCipherIndex = []uint16{
+	0x0004, 0x0005, 0x0007, 0x000a, 0x0016, 0x002f, 0x0033, 0x0035, 0x0039, 0x003c,
+	0x003d, 0x0041, 0x0045, 0x0067, 0x006b, 0x0084, 0x0088, 0x009a, 0x009c, 0x009d,
+	0x009e, 0x009f, 0x00ba, 0x00be, 0x00c0, 0x00c4, 0xc007, 0xc008, 0xc009, 0xc00a,
+	0xc011, 0xc012, 0xc013, 0xc014, 0xc023, 0xc024, 0xc027, 0xc028, 0xc02b, 0xc02c,
+	0xc02f, 0xc030, 0xc060, 0xc061, 0xc072, 0xc073, 0xc076, 0xc077, 0xc09c, 0xc09d,
+	0xc09e, 0xc09f, 0xc0a0, 0xc0a1, 0xc0a2, 0xc0a3, 0xc0ac, 0xc0ad, 0xc0ae, 0xc0af,
+	0xcc13, 0xcc14, 0xcca8, 0xcca9, 0x1301, 0x1302, 0x1303, 0x1304, 0x1305,
+}
+
+var (
+	jarmALPNs     = []string{"http/0.9", "http/1.0", "http/1.1", "spdy/1", "spdy/2", "spdy/3", "h2", "h2c", "hq"}
+	jarmRareALPNs = []string{"http/0.9", "http/1.0", "spdy/1", "spdy/2", "spdy/3", "h2c", "hq"}
+)
+
+// jarmMung reorders a list the way JARM reorders ciphers, ALPNs and
+// supported versions between probes.
+func jarmMung[T any](list []T, order string) []T {
+	n := len(list)
+	var out []T
+	switch order {
+	case jarmReverse:
+		for i := n - 1; i >= 0; i-- {
+			out = append(out, list[i])
+		}
+	case jarmBottomHalf:
+		if n%2 == 1 {
+			out = append(out, list[n/2+1:]...)
+		} else {
+			out = append(out, list[n/2:]...)
+		}
+	case jarmTopHalf:
+		if n%2 == 1 {
+			out = append(out, list[n/2])
+		}
+		out = append(out, jarmMung(jarmMung(list, jarmReverse), jarmBottomHalf)...)
+	case jarmMiddleOut:
+		mid := n / 2
+		if n%2 == 1 {
+			out = append(out, list[mid])
+			for i := 1; i <= mid; i++ {
+				out = append(out, list[mid+i], list[mid-i])
+			}
+		} else {
+			for i := 1; i <= mid; i++ {
+				out = append(out, list[mid-1+i], list[mid-i])
+			}
+		}
+	default:
+		out = append(out, list...)
+	}
+	return out
+}
+
+func randomGrease() []byte {
+	b := make([]byte, 1)
+	rand.Read(b)
+	g := b[0]&0xf0 | 0x0a
+	return []byte{g, g}
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	rand.Read(b)
+	return b
+}
+
+func appendUint16(b []byte, v int) []byte {
+	return binary.BigEndian.AppendUint16(b, uint16(v))
+}
+
+// clientHello builds the TLS record for a probe.
+func (p jarmProbe) clientHello(host string) []byte {
+	recordVersion, helloVersion := p.version, p.version
+	if p.version == 0x0304 {
+		recordVersion, helloVersion = 0x0301, 0x0303
+	}
+
+	var ciphers []uint16
+	for _, c := range jarmCiphers {
+		if p.noTLS13 && c>>8 == 0x13 {
+			continue
+		}
+		ciphers = append(ciphers, c)
+	}
+	ciphers = jarmMung(ciphers, p.cipherOrder)
+	var suites []byte
+	if p.grease {
+		suites = append(suites, randomGrease()...)
+	}
+	for _, c := range ciphers {
+		suites = appendUint16(suites, int(c))
+	}
+
+	hello := appendUint16(nil, int(helloVersion))
+	hello = append(hello, randomBytes(32)...)
+	hello = append(hello, 32)
+	hello = append(hello, randomBytes(32)...)
+	hello = appendUint16(hello, len(suites))
+	hello = append(hello, suites...)
+	hello = append(hello, 1, 0)
+	exts := p.extensions(host)
+	hello = appendUint16(hello, len(exts))
+	hello = append(hello, exts...)
+
+	handshake := []byte{1, 0}
+	handshake = appendUint16(handshake, len(hello))
+	handshake = append(handshake, hello...)
+	record := []byte{0x16}
+	record = appendUint16(record, int(recordVersion))
+	record = appendUint16(record, len(handshake))
+	return append(record, handshake...)
+}
+
+func (p jarmProbe) extensions(host string) []byte {
+	var ext []byte
+	if p.grease {
+		ext = append(ext, randomGrease()...)
+		ext = append(ext, 0, 0)
+	}
+	// server_name
+	ext = append(ext, 0, 0)
+	ext = appendUint16(ext, len(host)+5)
+	ext = appendUint16(ext, len(host)+3)
+	ext = append(ext, 0)
+	ext = appendUint16(ext, len(host))
+	ext = append(ext, host...)
+	// extended_master_secret, max_fragment_length, renegotiation_info,
+	// supported_groups, ec_point_formats and session_ticket
+	ext = append(ext,
+		0x00, 0x17, 0x00, 0x00,
+		0x00, 0x01, 0x00, 0x01, 0x01,
+		0xff, 0x01, 0x00, 0x01, 0x00,
+		0x00, 0x0a, 0x00, 0x0a, 0x00, 0x08, 0x00, 0x1d, 0x00, 0x17, 0x00, 0x18, 0x00, 0x19,
+		0x00, 0x0b, 0x00, 0x02, 0x01, 0x00,
+		0x00, 0x23, 0x00, 0x00,
+	)
+	alpns := jarmALPNs
+	if p.rareALPN {
+		alpns = jarmRareALPNs
+	}
+	var protos []byte
+	for _, a := range jarmMung(alpns, p.extOrder) {
+		protos = append(protos, byte(len(a)))
+		protos = append(protos, a...)
+	}
+	ext = append(ext, 0x00, 0x10)
+	ext = appendUint16(ext, len(protos)+2)
+	ext = appendUint16(ext, len(protos))
+	ext = append(ext, protos...)
+	// signature_algorithms
+	ext = append(ext,
+		0x00, 0x0d, 0x00, 0x14, 0x00, 0x12, 0x04, 0x03, 0x08, 0x04, 0x04, 0x01,
+		0x05, 0x03, 0x08, 0x05, 0x05, 0x01, 0x08, 0x06, 0x06, 0x01, 0x02, 0x01,
+	)
+	var share []byte
+	if p.grease {
+		share = append(share, randomGrease()...)
+		share = append(share, 0, 1, 0)
+	}
+	share = append(share, 0x00, 0x1d, 0x00, 0x20)
+	share = append(share, randomBytes(32)...)
+	ext = append(ext, 0x00, 0x33)
+	ext = appendUint16(ext, len(share)+2)
+	ext = appendUint16(ext, len(share))
+	ext = append(ext, share...)
+	// psk_key_exchange_modes
+	ext = append(ext, 0x00, 0x2d, 0x00, 0x02, 0x01, 0x01)
+	if p.version == 0x0304 || p.support == "1.2" {
+		versions := [][]byte{{3, 1}, {3, 2}, {3, 3}}
+		if p.support != "1.2" {
+			versions = append(versions, []byte{3, 4})
+		}
+		versions = jarmMung(versions, p.extOrder)
+		if p.grease {
+			versions = append([][]byte{randomGrease()}, versions...)
+		}
+		var vs []byte
+		for _, v := range versions {
+			vs = append(vs, v...)
+		}
+		ext = append(ext, 0x00, 0x2b)
+		ext = appendUint16(ext, len(vs)+1)
+		ext = append(ext, byte(len(vs)))
+		ext = append(ext, vs...)
+	}
+	return ext
+}
+
+// parseServerHello reduces a server's reply to JARM's
+// "cipher|version|alpn|extensions" form.
+func parseServerHello(data []byte) string {
+	if len(data) < 44 || data[0] != 0x16 || data[5] != 2 {
+		return "|||"
+	}
+	helloLen := int(binary.BigEndian.Uint16(data[3:5]))
+	sid := int(data[43])
+	if len(data) < sid+46 {
+		return "|||"
+	}
+	cipher := hex.EncodeToString(data[sid+44 : sid+46])
+	version := hex.EncodeToString(data[9:11])
+	return cipher + "|" + version + "|" + jarmExtensions(data, sid, helloLen)
+}
+
+func jarmExtensions(data []byte, sid, helloLen int) string {
+	at := func(i int) (byte, bool) {
+		if i >= len(data) {
+			return 0, false
+		}
+		return data[i], true
+	}
+	if b, ok := at(sid + 47); !ok || b == 11 {
+		return "|"
+	}
+	if len(data) >= sid+53 && string(data[sid+50:sid+53]) == "\x0e\xac\x0b" ||
+		len(data) >= 85 && string(data[82:85]) == "\x0f\xf0\x0b" ||
+		sid+42 >= helloLen {
+		return "|"
+	}
+	if len(data) < sid+49 {
+		return "|"
+	}
+	count := sid + 49
+	end := int(binary.BigEndian.Uint16(data[sid+47:sid+49])) + count - 1
+	var types []string
+	alpn := ""
+	for count < end {
+		if count+4 > len(data) {
+			return "|"
+		}
+		typ := data[count : count+2]
+		n := int(binary.BigEndian.Uint16(data[count+2 : count+4]))
+		if count+4+n > len(data) {
+			return "|"
+		}
+		if typ[0] == 0x00 && typ[1] == 0x10 && alpn == "" && n > 3 {
+			alpn = string(data[count+7 : count+4+n])
+		}
+		types = append(types, hex.EncodeToString(typ))
+		count += n + 4
+	}
+	return alpn + "|" + strings.Join(types, "-")
+}
+
+func jarmCipherByte(cipher string) string {
+	if cipher == "" {
+		return "00"
+	}
+	i := 0
+	for ; i < len(jarmCipherIndex); i++ {
+		if hex.EncodeToString(binary.BigEndian.AppendUint16(nil, jarmCipherIndex[i])) == cipher {
+			break
+		}
+	}
+	return hex.EncodeToString([]byte{byte(i + 1)})
+}
+
+func jarmVersionByte(version string) string {
+	if len(version) < 4 || version[3] < '0' || version[3] > '5' {
+		return "0"
+	}
+	return string("abcdef"[version[3]-'0'])
+}
+
+// jarmHash turns the raw probe results into the 62 character JARM
+// fingerprint: a cipher and version byte per probe followed by a truncated
+// SHA-256 of the ALPNs and extensions.
+func jarmHash(raw []string) string {
+	empty := true
+	for _, r := range raw {
+		if r != "|||" {
+			empty = false
+		}
+	}
+	if empty {
+		return strings.Repeat("0", 62)
+	}
+	var fuzzy, rest strings.Builder
+	for _, r := range raw {
+		parts := strings.SplitN(r, "|", 4)
+		for len(parts) < 4 {
+			parts = append(parts, "")
+		}
+		fuzzy.WriteString(jarmCipherByte(parts[0]))
+		fuzzy.WriteString(jarmVersionByte(parts[1]))
+		rest.WriteString(parts[2])
+		rest.WriteString(parts[3])
+	}
+	sum := sha256.Sum256([]byte(rest.String()))
+	return fuzzy.String() + hex.EncodeToString(sum[:])[:32]
+}
+
+func sendJARMProbe(p jarmProbe, host, addr string) string {
+	conn, err := net.DialTimeout("tcp", addr, 3*time.Second)
+	if err != nil {
+		return "|||"
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write(p.clientHello(host)); err != nil {
+		return "|||"
+	}
+	buf := make([]byte, 1484)
+	n, err := io.ReadAtLeast(conn, buf, 5)
+	if err != nil {
+		return "|||"
+	}
+	// Wait for the rest of the first record, up to the size JARM reads
+	want := min(5+int(binary.BigEndian.Uint16(buf[3:5])), len(buf))
+	if n < want {
+		m, _ := io.ReadAtLeast(conn, buf[n:], want-n)
+		n += m
+	}
+	return parseServerHello(buf[:n])
+}
+
+// JARM fingerprints the TLS server at addr by sending JARM's ten
+// ClientHellos with host as the server name.
+func JARM(host, addr string) string {
+	raw := make([]string, len(jarmProbes))
+	for i, p := range jarmProbes {
+		raw[i] = sendJARMProbe(p, host, addr)
+	}
+	return jarmHash(raw)
+}
+
+// GetJARM stores the JARM fingerprint of the domain's HTTPS server, so
+// domains served by the same TLS stack and configuration can be grouped.
+func (d *Domain) GetJARM() error {
+	d.LastRanJARM = time.Now()
+	if d.NonPublicDomain {
+		return errors.New("Non public domain")
+	}
+	addr := d.DomainName
+	if res, err := resolveHost(d.DomainName); err == nil && res != nil && len(res.ips) > 0 {
+		addr = res.ips[0]
+	}
+	d.JARM = JARM(d.DomainName, net.JoinHostPort(addr, "443"))
+	return nil
+}
@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"crypto/tls"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestJARMMung(t *testing.T) {
+	list := []int{1, 2, 3, 4, 5}
+	tests := map[string][]int{
+		jarmForward:    {1, 2, 3, 4, 5},
+		jarmReverse:    {5, 4, 3, 2, 1},
+		jarmBottomHalf: {4, 5},
+		jarmTopHalf:    {3, 2, 1},
+		jarmMiddleOut:  {3, 4, 2, 5, 1},
+	}
+	for order, want := range tests {
+		if got := jarmMung(list, order); !slices.Equal(got, want) {
+			t.Fatalf("expected %s to give %v, got %v", order, want, got)
+		}
+	}
+}
+
+func TestJARM(t *testing.T) {
+	cert, _ := testCertificate(t, "example.com")
+	tls12 := startTestTLSServer(t, &tls.Config{Certificates: []tls.Certificate{cert}, MaxVersion: tls.VersionTLS12})
+	tls13 := startTestTLSServer(t, &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"h2", "http/1.1"}})
+
+	a := JARM("example.com", tls12)
+	b := JARM("example.com", tls13)
+	if len(a) != 62 || a == strings.Repeat("0", 62) {
+		t.Fatalf("expected a fingerprint for the TLS 1.2 server, got %q", a)
+	}
+	if a == b {
+		t.Fatalf("expected different configurations to fingerprint differently, both got %s", a)
+	}
+	if again := JARM("example.com", tls13); again != b {
+		t.Fatalf("expected a stable fingerprint, got %s then %s", b, again)
+	}
+	if closed := JARM("example.com", "127.0.0.1:1"); closed != strings.Repeat("0", 62) {
+		t.Fatalf("expected an empty fingerprint for a closed port, got %s", closed)
+	}
+}
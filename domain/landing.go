@@ -0,0 +1,136 @@
+package domain
+
+import (
+	"bytes"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// LandingPage is the descriptive metadata of the page a domain lands on.
+type LandingPage struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Language    string `json:"language,omitempty"`
+	Canonical   string `json:"canonical,omitempty"`
+	OGSiteName  string `json:"ogSiteName,omitempty"`
+	OGURL       string `json:"ogURL,omitempty"`
+	Generator   string `json:"generator,omitempty"`
+}
+
+func tokenAttr(t html.Token, key string) string {
+	for _, a := range t.Attr {
+		if a.Key == key {
+			return strings.TrimSpace(a.Val)
+		}
+	}
+	return ""
+}
+
+// parseLandingPage reads the metadata out of body, resolving canonical and
+// og:url values against the page URL.
+func parseLandingPage(pageURL string, body []byte) *LandingPage {
+	lp := &LandingPage{URL: pageURL}
+	base, _ := url.Parse(pageURL)
+	resolve := func(ref string) string {
+		if ref == "" || base == nil {
+			return ref
+		}
+		if u, err := base.Parse(ref); err == nil {
+			return u.String()
+		}
+		return ref
+	}
+	var title strings.Builder
+	inTitle, seenTitle := false, false
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			lp.Title = strings.Join(strings.Fields(title.String()), " ")
+			return lp
+		case html.TextToken:
+			if inTitle {
+				title.Write(z.Text())
+			}
+		case html.EndTagToken:
+			if t := z.Token(); t.DataAtom == atom.Title {
+				inTitle = false
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			t := z.Token()
+			switch t.DataAtom {
+			case atom.Html:
+				if lp.Language == "" {
+					lp.Language = tokenAttr(t, "lang")
+				}
+			case atom.Title:
+				inTitle = tt == html.StartTagToken && !seenTitle
+				seenTitle = true
+			case atom.Meta:
+				name := strings.ToLower(tokenAttr(t, "name"))
+				if name == "" {
+					name = strings.ToLower(tokenAttr(t, "property"))
+				}
+				content := tokenAttr(t, "content")
+				switch {
+				case name == "description" && lp.Description == "":
+					lp.Description = content
+				case name == "generator" && lp.Generator == "":
+					lp.Generator = content
+				case name == "og:site_name" && lp.OGSiteName == "":
+					lp.OGSiteName = content
+				case name == "og:url" && lp.OGURL == "":
+					lp.OGURL = resolve(content)
+				case strings.EqualFold(tokenAttr(t, "http-equiv"), "content-language") && lp.Language == "":
+					lp.Language = content
+				}
+			case atom.Link:
+				if lp.Canonical == "" && strings.EqualFold(tokenAttr(t, "rel"), "canonical") {
+					lp.Canonical = resolve(tokenAttr(t, "href"))
+				}
+			}
+		}
+	}
+}
+
+// landingPageDomains merges the other registrable domains the landing page
+// names as its canonical or og:url into LandingPageDomains, recording which
+// of the two named it.
+func (d *Domain) landingPageDomains(lp *LandingPage) {
+	now := time.Now()
+	domsFound := make(map[string]*MatchedDomain)
+	for _, df := range d.LandingPageDomains {
+		domsFound[df.DomainName] = df
+	}
+	for _, ref := range []struct{ source, value string }{{"canonical", lp.Canonical}, {"og:url", lp.OGURL}} {
+		u, err := url.Parse(ref.value)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		dm, err := NewDomain(u.Hostname())
+		if err != nil || dm.DomainName == d.DomainName {
+			continue
+		}
+		md, exists := domsFound[dm.DomainName]
+		if !exists {
+			md = &MatchedDomain{CreatedAt: now, DomainName: dm.DomainName}
+			domsFound[dm.DomainName] = md
+		}
+		md.UpdatedAt = now
+		if !slices.Contains(md.Sources, ref.source) {
+			md.Sources = append(md.Sources, ref.source)
+		}
+	}
+	var lds []*MatchedDomain
+	for _, md := range domsFound {
+		lds = append(lds, md)
+	}
+	d.LandingPageDomains = lds
+}
@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"slices"
+	"testing"
+)
+
+const landingFixture = `<!DOCTYPE html>
+<html lang="en-GB">
+<head>
+<meta charset="utf-8">
+<title>
+  Example  Widgets &amp; Co
+</title>
+<meta name="Description" content="Widgets for every occasion">
+<meta name="generator" content="WordPress 6.5">
+<meta property="og:site_name" content="Example Widgets">
+<meta property="og:url" content="https://shop.example-widgets.net/">
+<link rel="canonical" href="/home">
+</head>
+<body><title>Not the title</title></body>
+</html>`
+
+func TestParseLandingPage(t *testing.T) {
+	lp := parseLandingPage("https://www.example.com/", []byte(landingFixture))
+	want := LandingPage{
+		URL:         "https://www.example.com/",
+		Title:       "Example Widgets & Co",
+		Description: "Widgets for every occasion",
+		Language:    "en-GB",
+		Canonical:   "https://www.example.com/home",
+		OGSiteName:  "Example Widgets",
+		OGURL:       "https://shop.example-widgets.net/",
+		Generator:   "WordPress 6.5",
+	}
+	if *lp != want {
+		t.Fatalf("expected %+v, got %+v", want, *lp)
+	}
+
+	d := &Domain{DomainName: "example.com"}
+	d.landingPageDomains(lp)
+	if len(d.LandingPageDomains) != 1 || d.LandingPageDomains[0].DomainName != "example-widgets.net" {
+		t.Fatalf("expected example-widgets.net from og:url, got %+v", d.LandingPageDomains)
+	}
+	if !slices.Equal(d.LandingPageDomains[0].Sources, []string{"og:url"}) {
+		t.Fatalf("expected og:url source, got %v", d.LandingPageDomains[0].Sources)
+	}
+}
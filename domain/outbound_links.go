@@ -0,0 +1,113 @@
+package domain
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// outboundLinkAttrs is the attribute holding the URL for each element type
+// whose links are collected.
+var outboundLinkAttrs = map[atom.Atom]string{
+	atom.A:      "href",
+	atom.Script: "src",
+	atom.Link:   "href",
+	atom.Iframe: "src",
+	atom.Form:   "action",
+}
+
+type outboundLink struct {
+	element string
+	url     *url.URL
+}
+
+// parseOutboundLinks returns the absolute http and https URLs referenced by
+// anchors, scripts, stylesheets, iframes and form actions in body.
+func parseOutboundLinks(pageURL string, body []byte) []outboundLink {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+	var links []outboundLink
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return links
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		t := z.Token()
+		key, ok := outboundLinkAttrs[t.DataAtom]
+		if !ok {
+			continue
+		}
+		if t.DataAtom == atom.Link && !slices.Contains(strings.Fields(strings.ToLower(tokenAttr(t, "rel"))), "stylesheet") {
+			continue
+		}
+		ref := tokenAttr(t, key)
+		if ref == "" {
+			continue
+		}
+		u, err := base.Parse(ref)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+		links = append(links, outboundLink{element: t.Data, url: u})
+	}
+}
+
+// GetOutboundLinkDomains collects the other registrable domains linked from
+// the landing page, recording in Sources the element types (a, script,
+// link, iframe, form) that referenced each. The page fetched by
+// GetRedirectDomains is reused when it ran first.
+func (d *Domain) GetOutboundLinkDomains() error {
+	d.LastRanOutboundLinks = time.Now()
+	if d.NonPublicDomain {
+		return errors.New("Non public domain")
+	}
+	if d.landingURL == "" {
+		for _, u := range d.webEntryPoints() {
+			if p := d.probeWeb(u); p.Reachable {
+				d.landingURL, d.landingBody = p.FinalURL, p.body
+				break
+			}
+		}
+		if d.landingURL == "" {
+			return errors.New("no web entry point reachable")
+		}
+	}
+	now := time.Now()
+	domsFound := make(map[string]*MatchedDomain)
+	for _, df := range d.OutboundLinkDomains {
+		domsFound[df.DomainName] = df
+	}
+	for _, link := range parseOutboundLinks(d.landingURL, d.landingBody) {
+		dm, err := NewDomain(link.url.Hostname())
+		if err != nil || dm.DomainName == d.DomainName {
+			continue
+		}
+		md, exists := domsFound[dm.DomainName]
+		if !exists {
+			md = &MatchedDomain{CreatedAt: now, DomainName: dm.DomainName}
+			domsFound[dm.DomainName] = md
+		}
+		md.UpdatedAt = now
+		if !slices.Contains(md.Sources, link.element) {
+			md.Sources = append(md.Sources, link.element)
+		}
+	}
+	var ods []*MatchedDomain
+	for _, md := range domsFound {
+		ods = append(ods, md)
+	}
+	d.OutboundLinkDomains = ods
+	return nil
+}
@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"slices"
+	"testing"
+)
+
+const outboundFixture = `<html><head>
+<link rel="stylesheet" href="https://cdn.example-static.net/site.css">
+<link rel="icon" href="https://icons.example.org/favicon.ico">
+<script src="//cdn.example-static.net/app.js"></script>
+</head><body>
+<a href="/about">About</a>
+<a href="https://www.example.com/contact">Contact</a>
+<a href="https://sister-brand.co.uk/">Our sister brand</a>
+<a href="mailto:info@example.org">Mail</a>
+<iframe src="https://player.example-video.com/embed/1"></iframe>
+<form action="https://forms.sister-brand.co.uk/subscribe"></form>
+</body></html>`
+
+func TestGetOutboundLinkDomains(t *testing.T) {
+	d := &Domain{DomainName: "example.com"}
+	d.landingURL, d.landingBody = "https://www.example.com/", []byte(outboundFixture)
+	if err := d.GetOutboundLinkDomains(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"example-static.net": {"link", "script"},
+		"sister-brand.co.uk": {"a", "form"},
+		"example-video.com":  {"iframe"},
+	}
+	if len(d.OutboundLinkDomains) != len(want) {
+		t.Fatalf("expected %d domains, got %+v", len(want), d.OutboundLinkDomains)
+	}
+	for _, md := range d.OutboundLinkDomains {
+		if !slices.Equal(md.Sources, want[md.DomainName]) {
+			t.Fatalf("expected %s from %v, got %v", md.DomainName, want[md.DomainName], md.Sources)
+		}
+	}
+	if got := d.GetAllMatchedDomains().OutboundLinkDomains; len(got) != len(want) {
+		t.Fatalf("expected outbound link domains in matched domains, got %v", got)
+	}
+}
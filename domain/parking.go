@@ -0,0 +1,196 @@
+package domain
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	SiteActive            = "active"
+	SiteParked            = "parked"
+	SiteForSale           = "for_sale"
+	SiteUnderConstruction = "under_construction"
+	SiteDefaultPage       = "default_page"
+	SiteError             = "error"
+)
+
+// SiteSignature identifies a class of site by the nameservers it is
+// delegated to, the domains it redirects to or its landing page.
+// Nameservers and redirect domains match by suffix. Page markers are lower
+// case substrings of the page's visible text; weak page markers only count
+// when they are in the title or the class has other evidence. Source
+// markers are lower case substrings of the raw HTML, for provider specific
+// script hosts and paths that never show on the page.
+type SiteSignature struct {
+	Class           string
+	Provider        string
+	Nameservers     []string
+	RedirectDomains []string
+	PageMarkers     []string
+	WeakPageMarkers []string
+	SourceMarkers   []string
+}
+
+var siteSignatures = []SiteSignature{
+	{Class: SiteParked, Provider: "Sedo", Nameservers: []string{"sedoparking.com"}, SourceMarkers: []string{"sedoparking"}},
+	{Class: SiteParked, Provider: "ParkingCrew", Nameservers: []string{"parkingcrew.net"}, SourceMarkers: []string{"parkingcrew"}},
+	{Class: SiteParked, Provider: "Bodis", Nameservers: []string{"bodis.com"}, SourceMarkers: []string{"bodis.com"}},
+	{Class: SiteParked, Provider: "Above", Nameservers: []string{"above.com"}},
+	{Class: SiteParked, Provider: "ParkLogic", Nameservers: []string{"parklogic.com"}},
+	{Class: SiteParked, PageMarkers: []string{
+		"this domain is parked", "this web page is parked", "parked free",
+	}, WeakPageMarkers: []string{"related searches"}},
+	{Class: SiteForSale, Provider: "Dan", Nameservers: []string{"dan.com"}, RedirectDomains: []string{"dan.com"}},
+	{Class: SiteForSale, Provider: "Afternic", Nameservers: []string{"afternic.com"}, RedirectDomains: []string{"afternic.com"}},
+	{Class: SiteForSale, Provider: "HugeDomains", Nameservers: []string{"hugedomains.com"}, RedirectDomains: []string{"hugedomains.com"}},
+	{Class: SiteForSale, Provider: "Sedo", RedirectDomains: []string{"sedo.com"}},
+	{Class: SiteForSale, Provider: "Undeveloped", RedirectDomains: []string{"undeveloped.com"}},
+	{Class: SiteForSale, Provider: "Efty", RedirectDomains: []string{"efty.com"}},
+	{Class: SiteForSale, Provider: "Atom", RedirectDomains: []string{"atom.com"}},
+	{Class: SiteForSale, Provider: "BuyDomains", RedirectDomains: []string{"buydomains.com"}},
+	{Class: SiteForSale, PageMarkers: []string{
+		"this domain is for sale", "this domain may be for sale", "domain is for sale", "buy this domain",
+		"make an offer on this domain", "inquire about this domain",
+	}},
+	{Class: SiteUnderConstruction, PageMarkers: []string{
+		"site is under construction", "site under construction", "site is being built", "site coming soon",
+	}, WeakPageMarkers: []string{"under construction", "coming soon", "launching soon"}},
+	{Class: SiteDefaultPage, PageMarkers: []string{
+		"welcome to nginx!", "apache2 ubuntu default page", "apache2 debian default page", "test page for the apache",
+		"iis windows server", "caddy works!", "web server's default page",
+	}, SourceMarkers: []string{"<h1>it works!</h1>", "defaultwebpage.cgi"}},
+}
+
+// SiteClassification is what the domain's website appears to be, along
+// with the signature matches that led there.
+type SiteClassification struct {
+	Class    string   `json:"class"`
+	Evidence []string `json:"evidence,omitempty"`
+}
+
+// pageText returns the lower case visible text of body and of its title,
+// leaving out scripts, styles and attributes.
+func pageText(body []byte) (text, title string) {
+	var all, head strings.Builder
+	var skip, inTitle bool
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			text = strings.Join(strings.Fields(strings.ToLower(all.String())), " ")
+			title = strings.Join(strings.Fields(strings.ToLower(head.String())), " ")
+			return text, title
+		case html.TextToken:
+			if !skip {
+				t := z.Text()
+				all.Write(t)
+				all.WriteByte(' ')
+				if inTitle {
+					head.Write(t)
+				}
+			}
+		case html.StartTagToken, html.EndTagToken:
+			t := z.Token()
+			switch t.DataAtom {
+			case atom.Script, atom.Style, atom.Noscript, atom.Template:
+				skip = tt == html.StartTagToken
+			case atom.Title:
+				inTitle = tt == html.StartTagToken
+			}
+		}
+	}
+}
+
+func hasDomainSuffix(name, suffix string) bool {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	return name == suffix || strings.HasSuffix(name, "."+suffix)
+}
+
+// classifySite matches the domain's nameservers and the landing probe
+// against siteSignatures. For sale outranks parked, and both outrank an
+// unreachable or failing site since parking pages often return errors.
+func (d *Domain) classifySite(landing *WebProbe, redirectDomains []string) *SiteClassification {
+	var source, text, title, finalHost string
+	if landing != nil {
+		source = strings.ToLower(string(landing.body))
+		text, title = pageText(landing.body)
+		if u, err := url.Parse(landing.FinalURL); err == nil {
+			finalHost = u.Hostname()
+		}
+	}
+	evidence := make(map[string][]string)
+	add := func(sig SiteSignature, format string, args ...any) {
+		e := fmt.Sprintf(format, args...)
+		if sig.Provider != "" {
+			e += " (" + sig.Provider + ")"
+		}
+		if !slices.Contains(evidence[sig.Class], e) {
+			evidence[sig.Class] = append(evidence[sig.Class], e)
+		}
+	}
+	for _, sig := range siteSignatures {
+		for _, suffix := range sig.Nameservers {
+			for _, ns := range d.NSRecords {
+				if ns.Active() && hasDomainSuffix(ns.NS, suffix) {
+					add(sig, "nameserver %s", strings.TrimSuffix(ns.NS, "."))
+				}
+			}
+		}
+		for _, suffix := range sig.RedirectDomains {
+			for _, rd := range redirectDomains {
+				if hasDomainSuffix(rd, suffix) {
+					add(sig, "redirects to %s", rd)
+				}
+			}
+			if finalHost != "" && hasDomainSuffix(finalHost, suffix) {
+				add(sig, "lands on %s", finalHost)
+			}
+		}
+		for _, marker := range sig.PageMarkers {
+			if strings.Contains(text, marker) {
+				add(sig, "page contains %q", marker)
+			}
+		}
+		for _, marker := range sig.SourceMarkers {
+			if strings.Contains(source, marker) {
+				add(sig, "page source contains %q", marker)
+			}
+		}
+	}
+	// Weak markers are common on ordinary pages, so they only back up other
+	// evidence unless the page is titled with them
+	for _, sig := range siteSignatures {
+		for _, marker := range sig.WeakPageMarkers {
+			switch {
+			case strings.Contains(title, marker):
+				add(sig, "title contains %q", marker)
+			case len(evidence[sig.Class]) > 0 && strings.Contains(text, marker):
+				add(sig, "page contains %q", marker)
+			}
+		}
+	}
+	for _, class := range []string{SiteForSale, SiteParked} {
+		if len(evidence[class]) > 0 {
+			return &SiteClassification{Class: class, Evidence: evidence[class]}
+		}
+	}
+	if landing == nil {
+		return &SiteClassification{Class: SiteError, Evidence: []string{"no web entry point reachable"}}
+	}
+	if landing.StatusCode >= 400 {
+		return &SiteClassification{Class: SiteError, Evidence: []string{fmt.Sprintf("status %d from %s", landing.StatusCode, landing.FinalURL)}}
+	}
+	for _, class := range []string{SiteDefaultPage, SiteUnderConstruction} {
+		if len(evidence[class]) > 0 {
+			return &SiteClassification{Class: class, Evidence: evidence[class]}
+		}
+	}
+	return &SiteClassification{Class: SiteActive}
+}
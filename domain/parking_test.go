@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"testing"
+)
+
+func TestClassifySite(t *testing.T) {
+	page := func(status int, body string) *WebProbe {
+		return &WebProbe{Reachable: true, StatusCode: status, FinalURL: "https://example.com/", body: []byte(body)}
+	}
+	tests := []struct {
+		name      string
+		ns        string
+		landing   *WebProbe
+		redirects []string
+		want      string
+	}{
+		{"active", "ns1.example.com.", page(200, "<title>Example Corp</title>"), nil, SiteActive},
+		{"parking nameserver", "ns1.sedoparking.com.", page(403, ""), nil, SiteParked},
+		{"parking text", "ns1.example.com.", page(200, "<p>This domain is parked free</p>"), nil, SiteParked},
+		{"parking source", "ns1.example.com.", page(200, `<script src="https://img.sedoparking.com/js/x.js"></script>`), nil, SiteParked},
+		{"related searches", "ns1.example.com.", page(200, "<title>Search results</title><h3>Related searches</h3>"), nil, SiteActive},
+		{"related searches on parking", "ns1.parklogic.com.", page(200, "<p>Related Searches:</p>"), nil, SiteParked},
+		{"for sale redirect", "ns1.example.com.", page(200, ""), []string{"dan.com"}, SiteForSale},
+		{"for sale outranks parked", "ns1.parkingcrew.net.", page(200, "This domain may be for sale!"), nil, SiteForSale},
+		{"under construction", "ns1.example.com.", page(200, "<title>Coming Soon</title>"), nil, SiteUnderConstruction},
+		{"under construction text", "ns1.example.com.", page(200, "<h1>Our site is under construction</h1>"), nil, SiteUnderConstruction},
+		{"coming soon product", "ns1.example.com.", page(200, "<title>Example Shop</title><div class=\"tile\"><h2>Coming Soon</h2>New sneakers</div>"), nil, SiteActive},
+		{"phrases outside text", "ns1.example.com.", page(200, `<title>Example Shop</title><script>var s = "under construction"</script><img alt="launching soon">`), nil, SiteActive},
+		{"default page", "ns1.example.com.", page(200, "<title>Welcome to nginx!</title>"), nil, SiteDefaultPage},
+		{"apache default page", "ns1.example.com.", page(200, "<html><body><h1>It works!</h1></body></html>"), nil, SiteDefaultPage},
+		{"server error", "ns1.example.com.", page(502, "Bad Gateway"), nil, SiteError},
+		{"unreachable", "ns1.example.com.", nil, nil, SiteError},
+	}
+	for _, tt := range tests {
+		d := &Domain{DomainName: "example.com", NSRecords: []NSRecord{{NS: tt.ns}}}
+		c := d.classifySite(tt.landing, tt.redirects)
+		if c.Class != tt.want {
+			t.Fatalf("%s: expected %s, got %+v", tt.name, tt.want, c)
+		}
+		if c.Class != SiteActive && len(c.Evidence) == 0 {
+			t.Fatalf("%s: expected evidence for %s", tt.name, c.Class)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package domain
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	defaultResolver   = "8.8.8.8:53"
+	defaultResolvConf = "/etc/resolv.conf"
+
+	dohMediaType = "application/dns-message"
+)
+
+// Resolver exchanges DNS messages with a single upstream server.
+type Resolver interface {
+	Exchange(msg *dns.Msg) (*dns.Msg, error)
+	String() string
+}
+
+// UDPResolver queries a nameserver over plain DNS using Client.DNS.
+type UDPResolver struct {
+	Addr string
+}
+
+func (r *UDPResolver) Exchange(msg *dns.Msg) (*dns.Msg, error) {
+	return query(msg, r.Addr)
+}
+
+func (r *UDPResolver) String() string {
+	return r.Addr
+}
+
+// TLSResolver queries a nameserver over DNS-over-TLS (RFC 7858).
+type TLSResolver struct {
+	Addr      string
+	TLSConfig *tls.Config
+}
+
+func (r *TLSResolver) Exchange(msg *dns.Msg) (*dns.Msg, error) {
+	c := &dns.Client{Net: "tcp-tls", TLSConfig: r.TLSConfig, Timeout: client.DNS.Timeout}
+	if c.TLSConfig == nil {
+		host, _, _ := net.SplitHostPort(r.Addr)
+		c.TLSConfig = &tls.Config{ServerName: host}
+	}
+	resp, _, err := c.Exchange(msg, r.Addr)
+	return resp, err
+}
+
+func (r *TLSResolver) String() string {
+	return "tls://" + r.Addr
+}
+
+// HTTPSResolver queries a DNS-over-HTTPS endpoint using the RFC 8484 wire
+// format. HTTP defaults to Client.HTTP when nil.
+type HTTPSResolver struct {
+	URL  string
+	HTTP *http.Client
+}
+
+func (r *HTTPSResolver) Exchange(msg *dns.Msg) (*dns.Msg, error) {
+	// RFC 8484 asks for an ID of 0 so responses can be cached by HTTP caches
+	m := msg.Copy()
+	m.Id = 0
+	packed, err := m.Pack()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", r.URL, bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", dohMediaType)
+	req.Header.Set("Accept", dohMediaType)
+	httpClient := r.HTTP
+	if httpClient == nil {
+		httpClient = client.HTTP
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got non-200 status code: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, err
+	}
+	reply := new(dns.Msg)
+	if err := reply.Unpack(body); err != nil {
+		return nil, err
+	}
+	reply.Id = msg.Id
+	return reply, nil
+}
+
+func (r *HTTPSResolver) String() string {
+	return r.URL
+}
+
+// ParseResolver builds a Resolver from a nameserver spec. Specs starting
+// with https:// use DoH, tls:// uses DoT, "iterative" resolves from the
+// root servers, and anything else, optionally prefixed with udp://, is a
+// plain nameserver address.
+func ParseResolver(spec string) (Resolver, error) {
+	spec = strings.TrimSpace(spec)
+	switch {
+	case spec == "":
+		return nil, errors.New("empty resolver")
+	case spec == "iterative":
+		return NewIterativeResolver(), nil
+	case strings.HasPrefix(spec, "https://"):
+		return &HTTPSResolver{URL: spec}, nil
+	case strings.HasPrefix(spec, "tls://"):
+		return &TLSResolver{Addr: withDefaultPort(strings.TrimPrefix(spec, "tls://"), "853")}, nil
+	default:
+		return &UDPResolver{Addr: withDefaultPort(strings.TrimPrefix(spec, "udp://"), "53")}, nil
+	}
+}
+
+func withDefaultPort(addr, port string) string {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return net.JoinHostPort(strings.Trim(addr, "[]"), port)
+	}
+	return addr
+}
+
+// ResolverError is the failure of a single resolver in the pool.
+type ResolverError struct {
+	Resolver string
+	Err      error
+}
+
+func (e *ResolverError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Resolver, e.Err)
+}
+
+func (e *ResolverError) Unwrap() error {
+	return e.Err
+}
+
+// ResolverPoolError is returned when every resolver in the pool failed.
+type ResolverPoolError struct {
+	Errors []*ResolverError
+}
+
+func (e *ResolverPoolError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, re := range e.Errors {
+		msgs[i] = re.Error()
+	}
+	return fmt.Sprintf("failed to query all servers: %s", strings.Join(msgs, "; "))
+}
+
+func (e *ResolverPoolError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, re := range e.Errors {
+		errs[i] = re
+	}
+	return errs
+}
+
+// ResolverPool rotates queries through a list of resolvers, retrying each
+// on timeouts and SERVFAIL before failing over to the next one.
+type ResolverPool struct {
+	Resolvers []Resolver
+	Attempts  int
+
+	next atomic.Uint32
+}
+
+func NewResolverPool(resolvers ...Resolver) *ResolverPool {
+	return &ResolverPool{Resolvers: resolvers, Attempts: 2}
+}
+
+// ParseResolverPool builds a pool from nameserver specs, see ParseResolver.
+func ParseResolverPool(specs []string) (*ResolverPool, error) {
+	var resolvers []Resolver
+	for _, spec := range specs {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		r, err := ParseResolver(spec)
+		if err != nil {
+			return nil, err
+		}
+		resolvers = append(resolvers, r)
+	}
+	return NewResolverPool(resolvers...), nil
+}
+
+// SetResolvers replaces the resolvers used for all DNS lookups.
+func SetResolvers(specs ...string) error {
+	pool, err := ParseResolverPool(specs)
+	if err != nil {
+		return err
+	}
+	client.Resolvers = pool
+	return nil
+}
+
+func resolversFromEnvironment() []string {
+	if env := os.Getenv("DNS_RESOLVERS"); env != "" {
+		return strings.Split(env, ",")
+	}
+	conf, err := dns.ClientConfigFromFile(defaultResolvConf)
+	if err == nil && len(conf.Servers) > 0 {
+		servers := make([]string, 0, len(conf.Servers))
+		for _, s := range conf.Servers {
+			servers = append(servers, net.JoinHostPort(s, conf.Port))
+		}
+		return servers
+	}
+	return []string{defaultResolver}
+}
+
+func newResolverPoolFromEnvironment() *ResolverPool {
+	pool, err := ParseResolverPool(resolversFromEnvironment())
+	if err != nil || len(pool.Resolvers) == 0 {
+		return NewResolverPool(&UDPResolver{Addr: defaultResolver})
+	}
+	return pool
+}
+
+func (p *ResolverPool) Exchange(msg *dns.Msg) (*dns.Msg, string, error) {
+	if len(p.Resolvers) == 0 {
+		return nil, "", errors.New("no resolvers configured")
+	}
+	start := int(p.next.Add(1) - 1)
+	var errs []*ResolverError
+	for i := range p.Resolvers {
+		resolver := p.Resolvers[(start+i)%len(p.Resolvers)]
+		r, err := p.exchangeWithRetry(msg, resolver)
+		if err == nil {
+			return r, resolver.String(), nil
+		}
+		errs = append(errs, &ResolverError{Resolver: resolver.String(), Err: err})
+	}
+	return nil, "", &ResolverPoolError{Errors: errs}
+}
+
+func (p *ResolverPool) exchangeWithRetry(msg *dns.Msg, resolver Resolver) (*dns.Msg, error) {
+	var err error
+	for attempt := 0; attempt < max(p.Attempts, 1); attempt++ {
+		var r *dns.Msg
+		r, err = resolver.Exchange(msg)
+		if err == nil {
+			switch r.Rcode {
+			case dns.RcodeSuccess, dns.RcodeNameError:
+				return r, nil
+			case dns.RcodeServerFailure:
+				err = ErrServFail
+				continue
+			default:
+				return nil, &RcodeError{Rcode: r.Rcode}
+			}
+		}
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			return nil, err
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,174 @@
+package domain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func testCertificate(t *testing.T, hosts ...string) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"Test Org"}, CommonName: hosts[0]},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              hosts,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, roots
+}
+
+func TestResolverPoolFailover(t *testing.T) {
+	bad := startTestDNSServer(t, servfailHandler)
+	good := startTestDNSServer(t, answerHandler("example.com. 300 IN A 192.0.2.1"))
+	pool, err := ParseResolverPool([]string{bad, good})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeA)
+	for i := 0; i < 2; i++ {
+		r, ns, err := pool.Exchange(msg)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		if ns != good {
+			t.Fatalf("expected answer from %s, got %s", good, ns)
+		}
+		if len(r.Answer) != 1 {
+			t.Fatalf("expected 1 answer, got %d", len(r.Answer))
+		}
+	}
+}
+
+func TestResolverPoolAllFailed(t *testing.T) {
+	first := startTestDNSServer(t, servfailHandler)
+	second := startTestDNSServer(t, servfailHandler)
+	pool := NewResolverPool(&UDPResolver{Addr: first}, &UDPResolver{Addr: second})
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeA)
+	_, _, err := pool.Exchange(msg)
+	var poolErr *ResolverPoolError
+	if !errors.As(err, &poolErr) {
+		t.Fatalf("expected ResolverPoolError, got %v", err)
+	}
+	for _, ns := range []string{first, second} {
+		if !strings.Contains(err.Error(), ns) {
+			t.Fatalf("expected error to name resolver %s, got %s", ns, err.Error())
+		}
+	}
+}
+
+func TestTLSResolver(t *testing.T) {
+	cert, roots := testCertificate(t, "localhost")
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{
+		Listener:          ln,
+		Net:               "tcp-tls",
+		Handler:           answerHandler("example.com. 300 IN A 192.0.2.1"),
+		NotifyStartedFunc: func() { close(started) },
+	}
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+
+	resolver := &TLSResolver{Addr: ln.Addr().String(), TLSConfig: &tls.Config{ServerName: "localhost", RootCAs: roots}}
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeA)
+	r, err := resolver.Exchange(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Answer) != 1 {
+		t.Fatalf("expected 1 answer, got %d", len(r.Answer))
+	}
+}
+
+func TestHTTPSResolver(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != dohMediaType {
+			http.Error(w, "bad content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		req := new(dns.Msg)
+		if err := req.Unpack(body); err != nil || req.Id != 0 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		packed, _ := answerFor(req, "example.com. 300 IN A 192.0.2.1").Pack()
+		w.Header().Set("Content-Type", dohMediaType)
+		w.Write(packed)
+	}))
+	defer server.Close()
+
+	resolver := &HTTPSResolver{URL: server.URL + "/dns-query", HTTP: server.Client()}
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeA)
+	r, err := resolver.Exchange(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Id != msg.Id {
+		t.Fatalf("expected reply id %d, got %d", msg.Id, r.Id)
+	}
+	if len(r.Answer) != 1 {
+		t.Fatalf("expected 1 answer, got %d", len(r.Answer))
+	}
+}
+
+func TestParseResolver(t *testing.T) {
+	for spec, expected := range map[string]string{
+		"9.9.9.9":                              "9.9.9.9:53",
+		"udp://[2620:fe::fe]":                  "[2620:fe::fe]:53",
+		"tls://1.1.1.1":                        "tls://1.1.1.1:853",
+		"https://cloudflare-dns.com/dns-query": "https://cloudflare-dns.com/dns-query",
+	} {
+		r, err := ParseResolver(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.String() != expected {
+			t.Fatalf("expected %s for %s, got %s", expected, spec, r.String())
+		}
+	}
+}
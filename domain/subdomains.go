@@ -0,0 +1,190 @@
+package domain
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	defaultSubdomainConcurrency = 10
+	wildcardProbes              = 3
+
+	SubdomainSourceWordlist = "wordlist"
+)
+
+// DefaultSubdomainWordlist is used for enumeration when no wordlist is
+// configured.
+var DefaultSubdomainWordlist = []string{
+	"www", "mail", "webmail", "smtp", "imap", "pop", "mx", "ns1", "ns2", "dns",
+	"vpn", "remote", "gateway", "portal", "intranet", "extranet", "sso", "auth",
+	"login", "admin", "api", "app", "apps", "m", "mobile", "dev", "test",
+	"staging", "stage", "uat", "qa", "demo", "beta", "sandbox", "blog", "news",
+	"shop", "store", "cdn", "static", "assets", "img", "images", "media",
+	"files", "docs", "support", "help", "status", "jobs", "careers", "git",
+	"jira", "confluence", "wiki", "crm", "erp", "ftp", "autodiscover", "owa",
+	"exchange", "cloud", "secure", "partners", "investors", "events",
+}
+
+type SubdomainRecord struct {
+	CreatedAt time.Time `json:"createdAt,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt,omitempty"`
+	Name      string    `json:"name"`
+	IPs       []string  `json:"ips,omitempty"`
+	CNAME     string    `json:"cname,omitempty"`
+	Source    string    `json:"source"`
+}
+
+type subdomainAnswer struct {
+	ips   []string
+	cname string
+}
+
+// resolveHost looks up the A records of name, returning nil when it does
+// not resolve.
+func resolveHost(name string) (*subdomainAnswer, error) {
+	answer, _, err := queryAnswer(name, dns.TypeA)
+	if errors.Is(err, ErrNXDomain) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := &subdomainAnswer{}
+	for _, ans := range answer {
+		switch a := ans.(type) {
+		case *dns.A:
+			res.ips = append(res.ips, a.A.String())
+		case *dns.CNAME:
+			if res.cname == "" {
+				res.cname = strings.ToLower(a.Target)
+			}
+		}
+	}
+	if len(res.ips) == 0 && res.cname == "" {
+		return nil, nil
+	}
+	slices.Sort(res.ips)
+	return res, nil
+}
+
+// detectWildcard resolves random labels under the domain and returns the
+// answers a wildcard record hands out, or nil when there is no wildcard.
+func (d *Domain) detectWildcard() ([]*subdomainAnswer, error) {
+	var wildcards []*subdomainAnswer
+	for i := 0; i < wildcardProbes; i++ {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		res, err := resolveHost(hex.EncodeToString(b) + "." + d.DomainName)
+		if err != nil {
+			return nil, err
+		}
+		if res != nil {
+			wildcards = append(wildcards, res)
+		}
+	}
+	return wildcards, nil
+}
+
+// matchesWildcard reports whether res is explained by a wildcard answer.
+func matchesWildcard(res *subdomainAnswer, wildcards []*subdomainAnswer) bool {
+	for _, w := range wildcards {
+		if res.cname != "" && res.cname == w.cname {
+			return true
+		}
+		if len(res.ips) > 0 && !slices.ContainsFunc(res.ips, func(ip string) bool { return !slices.Contains(w.ips, ip) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetSubdomains brute forces subdomains from wordlist (DefaultSubdomainWordlist
+// when empty) with up to concurrency lookups in flight. Names that only
+// resolve because of wildcard DNS are discarded.
+func (d *Domain) GetSubdomains(wordlist []string, concurrency int) error {
+	d.LastRanSubdomainEnum = time.Now()
+	if d.NonPublicDomain {
+		return errors.New("Non public domain")
+	}
+	if len(wordlist) == 0 {
+		wordlist = DefaultSubdomainWordlist
+	}
+	if concurrency <= 0 {
+		concurrency = defaultSubdomainConcurrency
+	}
+	wildcards, err := d.detectWildcard()
+	if err != nil {
+		return err
+	}
+	d.WildcardDNS = len(wildcards) > 0
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		found = make(map[string]*subdomainAnswer)
+		errs  []error
+		sem   = make(chan struct{}, concurrency)
+	)
+	for _, word := range wordlist {
+		name := strings.ToLower(strings.TrimSpace(word)) + "." + d.DomainName
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			res, err := resolveHost(name)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			if res != nil && !matchesWildcard(res, wildcards) {
+				found[name] = res
+			}
+		}()
+	}
+	wg.Wait()
+	if len(errs) > 0 && len(errs) == len(wordlist) {
+		return errors.Join(errs...)
+	}
+	for name, res := range found {
+		d.addSubdomain(name, res.ips, res.cname, SubdomainSourceWordlist)
+	}
+	return nil
+}
+
+// addSubdomain records name, refreshing it when it was already known.
+func (d *Domain) addSubdomain(name string, ips []string, cname, source string) {
+	now := time.Now()
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	for _, s := range d.Subdomains {
+		if s.Name == name {
+			s.UpdatedAt = now
+			if len(ips) > 0 {
+				s.IPs = ips
+			}
+			if cname != "" {
+				s.CNAME = cname
+			}
+			return
+		}
+	}
+	d.Subdomains = append(d.Subdomains, &SubdomainRecord{
+		CreatedAt: now,
+		UpdatedAt: now,
+		Name:      name,
+		IPs:       ips,
+		CNAME:     cname,
+		Source:    source,
+	})
+}
@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestGetSubdomainsFiltersWildcard(t *testing.T) {
+	addr := startTestDNSServer(t, func(w dns.ResponseWriter, req *dns.Msg) {
+		m := answerFor(req,
+			"www.example.com. 300 IN A 192.0.2.1",
+			"mail.example.com. 300 IN A 192.0.2.2",
+		)
+		if len(m.Answer) == 0 && strings.HasSuffix(req.Question[0].Name, ".example.com.") {
+			rr, _ := dns.NewRR(req.Question[0].Name + " 300 IN A 192.0.2.99")
+			m.Answer = append(m.Answer, rr)
+		}
+		w.WriteMsg(m)
+	})
+	useTestResolvers(t, addr)
+
+	d := &Domain{DomainName: "example.com"}
+	if err := d.GetSubdomains([]string{"www", "mail", "nothing", "vpn"}, 2); err != nil {
+		t.Fatal(err)
+	}
+	if !d.WildcardDNS {
+		t.Fatal("expected wildcard DNS to be detected")
+	}
+	if len(d.Subdomains) != 2 {
+		t.Fatalf("expected 2 subdomains, got %+v", d.Subdomains)
+	}
+	for _, s := range d.Subdomains {
+		if s.Name != "www.example.com" && s.Name != "mail.example.com" {
+			t.Fatalf("unexpected subdomain %s", s.Name)
+		}
+	}
+}
@@ -1,19 +1,201 @@
 package domain
 
 import (
+	"bytes"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/weppos/publicsuffix-go/publicsuffix"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
-func (d *Domain) GetRedirectDomains() error {
-	d.LastRanWebRedirect = time.Now()
-	hosts := make(map[string]bool)
-	finalURL := fmt.Sprintf("https://%s", d.DomainName)
+// RedirectHop is one request made while following a domain's redirects.
+// Method is how the redirect leading to it was found, empty for the first
+// request. SchemeChanged and DomainChanged compare it with the previous hop.
+type RedirectHop struct {
+	URL           string        `json:"url"`
+	Method        string        `json:"method,omitempty"`
+	StatusCode    int           `json:"statusCode,omitempty"`
+	Location      string        `json:"location,omitempty"`
+	Server        string        `json:"server,omitempty"`
+	Duration      time.Duration `json:"duration"`
+	SchemeChanged bool          `json:"schemeChanged,omitempty"`
+	DomainChanged bool          `json:"domainChanged,omitempty"`
+	Error         string        `json:"error,omitempty"`
+}
+
+// hopRecorder wraps a transport and records every response it sees, so the
+// redirect chain has status codes, headers and timing as well as URLs.
+type hopRecorder struct {
+	base   http.RoundTripper
+	hops   []RedirectHop
+	method string
+}
+
+func (h *hopRecorder) visited(u string) bool {
+	for _, hop := range h.hops {
+		if strings.TrimSuffix(hop.URL, "/") == strings.TrimSuffix(u, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *hopRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	hop := RedirectHop{URL: req.URL.String(), Method: h.method}
+	h.method = RedirectMethodHTTP
+	if n := len(h.hops); n > 0 {
+		if prev, err := url.Parse(h.hops[n-1].URL); err == nil {
+			hop.SchemeChanged = prev.Scheme != req.URL.Scheme
+			hop.DomainChanged = registrableDomain(prev.Hostname()) != registrableDomain(req.URL.Hostname())
+		}
+	}
+	start := time.Now()
+	resp, err := h.base.RoundTrip(req)
+	hop.Duration = time.Since(start)
+	if err != nil {
+		hop.Error = err.Error()
+	} else {
+		hop.StatusCode = resp.StatusCode
+		hop.Location = resp.Header.Get("Location")
+		hop.Server = resp.Header.Get("Server")
+	}
+	h.hops = append(h.hops, hop)
+	return resp, err
+}
+
+// registrableDomain returns the registrable domain of host, or host itself
+// when it has none.
+func registrableDomain(host string) string {
+	dom, err := publicsuffix.ParseFromListWithOptions(
+		publicsuffix.DefaultList, host, &publicsuffix.FindOptions{IgnorePrivate: false},
+	)
+	if err != nil || dom == nil {
+		return host
+	}
+	return fmt.Sprintf("%s.%s", dom.SLD, dom.TLD)
+}
+
+// Ways a redirect can be found. HTTP redirects come from 3xx responses;
+// the others are parsed out of the landing page.
+const (
+	RedirectMethodHTTP        = "http"
+	RedirectMethodMetaRefresh = "meta_refresh"
+	RedirectMethodJavaScript  = "javascript"
+	RedirectMethodCanonical   = "canonical"
+)
+
+// maxClientRedirects limits how many redirects parsed from pages are
+// followed, on top of the HTTP redirects the client follows itself.
+const maxClientRedirects = 5
+
+var (
+	refreshRegex    = regexp.MustCompile(`(?i)^\s*\d*(?:\.\d*)?\s*[;,]?\s*url\s*=\s*['"]?([^'"]+)`)
+	jsLocationRegex = regexp.MustCompile(`(?:\b(?:window|document|top|self)\.)?\blocation(?:\.href)?\s*=\s*["']([^"']+)["']|\blocation\.(?:replace|assign)\(\s*["']([^"']+)["']`)
+)
+
+// clientRedirectTargets returns the first meta refresh target, JavaScript
+// location assignment inside a script element and canonical link in body.
+func clientRedirectTargets(body []byte) (refresh, script, canonical string) {
+	inScript := false
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			return refresh, script, canonical
+		case html.TextToken:
+			if inScript && script == "" {
+				if m := jsLocationRegex.FindSubmatch(z.Text()); m != nil {
+					script = string(m[1]) + string(m[2])
+				}
+			}
+		case html.EndTagToken:
+			if t := z.Token(); t.DataAtom == atom.Script {
+				inScript = false
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			t := z.Token()
+			switch t.DataAtom {
+			case atom.Script:
+				inScript = tt == html.StartTagToken
+			case atom.Meta:
+				if refresh == "" && strings.EqualFold(tokenAttr(t, "http-equiv"), "refresh") {
+					if m := refreshRegex.FindStringSubmatch(tokenAttr(t, "content")); m != nil {
+						refresh = m[1]
+					}
+				}
+			case atom.Link:
+				if canonical == "" && strings.EqualFold(tokenAttr(t, "rel"), "canonical") {
+					canonical = tokenAttr(t, "href")
+				}
+			}
+		}
+	}
+}
+
+// parseClientRedirect looks for a redirect in a page that the HTTP client
+// cannot see: a meta refresh, a JavaScript location assignment or, failing
+// those, a canonical link. The target is resolved against base.
+func parseClientRedirect(body []byte, base *url.URL) (*url.URL, string) {
+	refresh, script, canonical := clientRedirectTargets(body)
+	var target, method string
+	switch {
+	case refresh != "":
+		target, method = refresh, RedirectMethodMetaRefresh
+	case script != "":
+		target, method = script, RedirectMethodJavaScript
+	case canonical != "":
+		target, method = canonical, RedirectMethodCanonical
+	default:
+		return nil, ""
+	}
+	u, err := base.Parse(strings.TrimSpace(target))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, ""
+	}
+	u.Fragment = ""
+	return u, method
+}
+
+// redirectResult is what followRedirects saw: every hop, the final URL and
+// page, and the other registrable domains redirected to with how each
+// redirect was found.
+type redirectResult struct {
+	hops       []RedirectHop
+	finalURL   string
+	hosts      map[string][]string
+	statusCode int
+	body       []byte
+}
+
+// followRedirects requests start and follows its redirects, both HTTP and
+// those found in the page.
+func (d *Domain) followRedirects(start string) (*redirectResult, error) {
+	hosts := make(map[string][]string)
+	addHost := func(u *url.URL, method string) {
+		dom, err := publicsuffix.ParseFromListWithOptions(
+			publicsuffix.DefaultList, u.Hostname(), &publicsuffix.FindOptions{IgnorePrivate: false},
+		)
+		if err == nil && dom != nil {
+			if dn := fmt.Sprintf("%s.%s", dom.SLD, dom.TLD); dn != d.DomainName && !slices.Contains(hosts[dn], method) {
+				hosts[dn] = append(hosts[dn], method)
+			}
+		}
+	}
+	finalURL := start
 	transport := &http.Transport{
 		DialContext: (&net.Dialer{
 			Timeout:   5 * time.Second, // Maximum amount of time to wait for a dial to complete
@@ -24,47 +206,184 @@ func (d *Domain) GetRedirectDomains() error {
 		ExpectContinueTimeout: 1 * time.Second, // Maximum amount of time to wait for a 100-continue response from the server
 		Proxy:                 http.ProxyFromEnvironment,
 	}
+	recorder := &hopRecorder{base: transport}
 	redir_client := &http.Client{
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			dom, err := publicsuffix.ParseFromListWithOptions(
-				publicsuffix.DefaultList, req.URL.Hostname(), &publicsuffix.FindOptions{IgnorePrivate: false},
-			)
-			if err == nil && dom != nil {
-				if dn := fmt.Sprintf("%s.%s", dom.SLD, dom.TLD); dn != d.DomainName {
-					hosts[fmt.Sprintf("%s.%s", dom.SLD, dom.TLD)] = true
-				}
-			}
+			addHost(req.URL, RedirectMethodHTTP)
 			finalURL = req.URL.String()
 			return nil
 		},
-		Transport: transport,
+		Transport: recorder,
 		Timeout:   10 * time.Second,
 	}
 
-	// Make the initial request
-	resp, err := redir_client.Get(fmt.Sprintf("http://%s", d.DomainName))
+	// Make the initial request, then follow any redirects found in the page
+	target := start
+	var statusCode int
+	var page []byte
+	var landedURL string
+	var landedHosts map[string][]string
+	for i := 0; ; i++ {
+		resp, err := redir_client.Get(target)
+		if err != nil && i == 0 {
+			res := &redirectResult{hops: recorder.hops, finalURL: finalURL, hosts: hosts}
+			return res, fmt.Errorf("failed to make request: %w", err)
+		}
+		if err != nil {
+			// The failed hop is in the chain, but the domain still lands
+			// on the last page that loaded
+			res := &redirectResult{hops: recorder.hops, finalURL: landedURL, hosts: landedHosts, statusCode: statusCode, body: page}
+			return res, nil
+		}
+		var next *url.URL
+		var method string
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		resp.Body.Close()
+		statusCode, page = resp.StatusCode, body
+		if resp.StatusCode == http.StatusOK && strings.Contains(resp.Header.Get("Content-Type"), "html") {
+			next, method = parseClientRedirect(body, resp.Request.URL)
+		}
+		if next == nil || i >= maxClientRedirects || recorder.visited(next.String()) {
+			break
+		}
+		landedURL = finalURL
+		landedHosts = make(map[string][]string, len(hosts))
+		for h, methods := range hosts {
+			landedHosts[h] = slices.Clone(methods)
+		}
+		addHost(next, method)
+		recorder.method = method
+		target = next.String()
+		finalURL = target
+	}
+	return &redirectResult{hops: recorder.hops, finalURL: finalURL, hosts: hosts, statusCode: statusCode, body: page}, nil
+}
+
+// WebProbe is the outcome of requesting one of the domain's web entry
+// points and following its redirects.
+type WebProbe struct {
+	URL             string        `json:"url"`
+	Reachable       bool          `json:"reachable"`
+	StatusCode      int           `json:"statusCode,omitempty"`
+	TLSError        string        `json:"tlsError,omitempty"`
+	Error           string        `json:"error,omitempty"`
+	FinalURL        string        `json:"finalURL,omitempty"`
+	RedirectDomains []string      `json:"redirectDomains,omitempty"`
+	Chain           []RedirectHop `json:"chain,omitempty"`
+
+	redirects map[string][]string
+	body      []byte
+}
+
+// webEntryPoints are the URLs GetRedirectDomains probes, in order of
+// preference.
+func (d *Domain) webEntryPoints() []string {
+	return []string{
+		fmt.Sprintf("https://%s", d.DomainName),
+		fmt.Sprintf("https://www.%s", d.DomainName),
+		fmt.Sprintf("http://%s", d.DomainName),
+		fmt.Sprintf("http://www.%s", d.DomainName),
+	}
+}
+
+func isTLSError(err error) bool {
+	var verifyErr *tls.CertificateVerificationError
+	var headerErr tls.RecordHeaderError
+	return errors.As(err, &verifyErr) || errors.As(err, &headerErr) || strings.Contains(err.Error(), "tls: ")
+}
+
+func (d *Domain) probeWeb(start string) WebProbe {
+	res, err := d.followRedirects(start)
+	p := WebProbe{URL: start, Chain: res.hops, redirects: res.hosts}
 	if err != nil {
-		d.SuccessfulWebLanding = false
-		d.WebRedirectDomains = []*MatchedDomain{}
-		return fmt.Errorf("failed to make request: %v", err)
+		p.Error = err.Error()
+		if isTLSError(err) {
+			p.TLSError = errors.Unwrap(err).Error()
+		}
+		return p
+	}
+	p.Reachable = true
+	p.StatusCode = res.statusCode
+	p.FinalURL = res.finalURL
+	p.body = res.body
+	for host := range res.hosts {
+		p.RedirectDomains = append(p.RedirectDomains, host)
+	}
+	slices.Sort(p.RedirectDomains)
+	return p
+}
+
+// GetRedirectDomains probes the domain over HTTPS and HTTP, on both the apex
+// and www. Redirect domains are merged from every probe, while the final URL
+// and redirect chain come from the first reachable entry point. The domain
+// lands successfully when any entry point serves a page without redirecting
+// to another domain. The landing page is then classified as an active site,
+// parked, for sale and so on, and its metadata is stored in LandingPage.
+func (d *Domain) GetRedirectDomains() error {
+	d.LastRanWebRedirect = time.Now()
+	return d.landWeb(d.webEntryPoints())
+}
+
+func (d *Domain) landWeb(urls []string) error {
+	probes := make([]WebProbe, len(urls))
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			probes[i] = d.probeWeb(u)
+		}()
 	}
-	defer resp.Body.Close()
+	wg.Wait()
+	d.WebProbes = probes
 
-	d.WebRedirectURLFinal = finalURL
-	if len(hosts) == 0 {
-		d.SuccessfulWebLanding = true
+	d.SuccessfulWebLanding = false
+	var primary *WebProbe
+	hosts := make(map[string][]string)
+	for i := range probes {
+		p := &probes[i]
+		if !p.Reachable {
+			continue
+		}
+		if primary == nil {
+			primary = p
+		}
+		if len(p.RedirectDomains) == 0 {
+			d.SuccessfulWebLanding = true
+		}
+		for host, methods := range p.redirects {
+			for _, m := range methods {
+				if !slices.Contains(hosts[host], m) {
+					hosts[host] = append(hosts[host], m)
+				}
+			}
+		}
+	}
+	var redirectDomains []string
+	for host := range hosts {
+		redirectDomains = append(redirectDomains, host)
+	}
+	slices.Sort(redirectDomains)
+	d.SiteClassification = d.classifySite(primary, redirectDomains)
+	if primary == nil {
+		d.WebRedirectChain = nil
 		d.WebRedirectDomains = []*MatchedDomain{}
-		return nil
+		return fmt.Errorf("no web entry point reachable: %s", probes[0].Error)
 	}
+	d.WebRedirectChain = primary.Chain
+	d.WebRedirectURLFinal = primary.FinalURL
+	d.landingURL, d.landingBody = primary.FinalURL, primary.body
+	d.LandingPage = parseLandingPage(primary.FinalURL, primary.body)
+	d.landingPageDomains(d.LandingPage)
 	now := time.Now()
-	var wrs []*MatchedDomain
-	for host := range hosts {
+	wrs := []*MatchedDomain{}
+	for host, methods := range hosts {
 		rdom, err := NewDomain(host)
 		if err != nil {
 			log.Println(err)
 			continue
 		}
-		wr := &MatchedDomain{CreatedAt: now, UpdatedAt: now, DomainName: rdom.DomainName}
+		wr := &MatchedDomain{CreatedAt: now, UpdatedAt: now, DomainName: rdom.DomainName, Sources: methods}
 		wrs = append(wrs, wr)
 	}
 	d.WebRedirectDomains = wrs
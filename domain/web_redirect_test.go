@@ -0,0 +1,173 @@
+package domain
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFollowRedirectsRecordsChain(t *testing.T) {
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer secure.Close()
+	middle := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, secure.URL+"/landing", http.StatusMovedPermanently)
+	}))
+	defer middle.Close()
+	start := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "parking/1.0")
+		http.Redirect(w, r, strings.Replace(middle.URL, "127.0.0.1", "localhost", 1), http.StatusFound)
+	}))
+	defer start.Close()
+
+	d := &Domain{DomainName: "example.com"}
+	res, err := d.followRedirects(start.URL)
+	if err == nil {
+		t.Fatal("expected the untrusted TLS hop to fail")
+	}
+	chain := res.hops
+	if len(chain) != 3 {
+		t.Fatalf("expected 3 hops, got %+v", chain)
+	}
+	first, second, third := chain[0], chain[1], chain[2]
+	if first.StatusCode != http.StatusFound || first.Server != "parking/1.0" || !strings.Contains(first.Location, "localhost") {
+		t.Fatalf("unexpected first hop %+v", first)
+	}
+	if second.StatusCode != http.StatusMovedPermanently || !second.DomainChanged || second.SchemeChanged {
+		t.Fatalf("unexpected second hop %+v", second)
+	}
+	if !third.SchemeChanged || !third.DomainChanged || third.Error == "" || third.StatusCode != 0 {
+		t.Fatalf("unexpected third hop %+v", third)
+	}
+}
+
+func TestParseClientRedirect(t *testing.T) {
+	base, _ := url.Parse("http://example.com/start")
+	tests := []struct {
+		body   string
+		target string
+		method string
+	}{
+		{`<meta content="0; URL='https://example.net/landing'" http-equiv="Refresh">`, "https://example.net/landing", RedirectMethodMetaRefresh},
+		{`<META HTTP-EQUIV=refresh CONTENT="5;url=/next">`, "http://example.com/next", RedirectMethodMetaRefresh},
+		{`<script>window.location.href = "https://shop.example.org/";</script>`, "https://shop.example.org/", RedirectMethodJavaScript},
+		{`<script>location.replace('https://example.net/x#top')</script>`, "https://example.net/x", RedirectMethodJavaScript},
+		{`<link href="https://www.example.net/" rel="canonical">`, "https://www.example.net/", RedirectMethodCanonical},
+		{`<script>if (location == "x") {}</script><a href="https://example.net">`, "", ""},
+		{`<meta http-equiv="refresh" content="0;url=javascript:alert(1)">`, "", ""},
+		{`<button onclick="window.location.href='https://partner-shop.net/'">Shop</button>`, "", ""},
+		{`<p>Set location = "https://example.net/" in your config</p>`, "", ""},
+	}
+	for _, tt := range tests {
+		u, method := parseClientRedirect([]byte(tt.body), base)
+		got := ""
+		if u != nil {
+			got = u.String()
+		}
+		if got != tt.target || method != tt.method {
+			t.Fatalf("%s: expected %s %q, got %s %q", tt.body, tt.method, tt.target, method, got)
+		}
+	}
+}
+
+func TestFollowRedirectsClientSide(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<meta http-equiv="refresh" content="0;url=%s/js">`, strings.Replace(srv.URL, "127.0.0.1", "localhost", 1))
+		case "/js":
+			fmt.Fprint(w, `<script>window.location = "/moved"</script>`)
+		case "/moved":
+			http.Redirect(w, r, "/final", http.StatusFound)
+		case "/final":
+			fmt.Fprint(w, `<link rel="canonical" href="/final">`)
+		}
+	}))
+	defer srv.Close()
+
+	d := &Domain{DomainName: "example.com"}
+	res, err := d.followRedirects(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, finalURL := res.hops, res.finalURL
+	var methods []string
+	for _, hop := range chain {
+		methods = append(methods, hop.Method)
+	}
+	want := []string{"", RedirectMethodMetaRefresh, RedirectMethodJavaScript, RedirectMethodHTTP}
+	if !slices.Equal(methods, want) {
+		t.Fatalf("expected hop methods %v, got %v", want, methods)
+	}
+	if !strings.HasSuffix(finalURL, "/final") {
+		t.Fatalf("expected to end on /final, got %s", finalURL)
+	}
+}
+
+func TestLandWebProbesEntryPoints(t *testing.T) {
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer secure.Close()
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/home", http.StatusFound)
+		}
+	}))
+	defer plain.Close()
+	closed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closed.Close()
+
+	d := &Domain{DomainName: "example.com"}
+	if err := d.landWeb([]string{secure.URL, closed.URL, plain.URL}); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.WebProbes) != 3 {
+		t.Fatalf("expected 3 probes, got %+v", d.WebProbes)
+	}
+	if p := d.WebProbes[0]; p.Reachable || p.TLSError == "" {
+		t.Fatalf("expected a TLS error for the untrusted server, got %+v", p)
+	}
+	if p := d.WebProbes[1]; p.Reachable || p.TLSError != "" || p.Error == "" {
+		t.Fatalf("expected a plain connection error for the closed server, got %+v", p)
+	}
+	if p := d.WebProbes[2]; !p.Reachable || p.FinalURL != plain.URL+"/home" {
+		t.Fatalf("expected the plain server to land on /home, got %+v", p)
+	}
+	if !d.SuccessfulWebLanding || d.WebRedirectURLFinal != plain.URL+"/home" || len(d.WebRedirectChain) != 2 {
+		t.Fatalf("expected landing from the plain server, got %v %s %+v", d.SuccessfulWebLanding, d.WebRedirectURLFinal, d.WebRedirectChain)
+	}
+
+	if err := d.landWeb([]string{closed.URL}); err == nil || d.SuccessfulWebLanding {
+		t.Fatal("expected no landing when nothing is reachable")
+	}
+}
+
+func TestLandWebDeadClientRedirect(t *testing.T) {
+	tests := map[string]string{
+		"canonical":    `<link rel="canonical" href="http://127.0.0.1:1/">`,
+		"meta refresh": `<meta http-equiv="refresh" content="0;url=http://127.0.0.1:1/">`,
+	}
+	for name, body := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, body)
+		}))
+		d := &Domain{DomainName: "example.com"}
+		err := d.landWeb([]string{srv.URL})
+		srv.Close()
+		if err != nil {
+			t.Fatalf("%s: expected the page to count as landing, got %v", name, err)
+		}
+		p := d.WebProbes[0]
+		if !p.Reachable || !d.SuccessfulWebLanding || p.FinalURL != srv.URL || p.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected landing on %s, got %+v", name, srv.URL, p)
+		}
+		if len(p.Chain) != 2 || p.Chain[1].Error == "" {
+			t.Fatalf("%s: expected the dead hop to be recorded as failed, got %+v", name, p.Chain)
+		}
+	}
+}
@@ -9,13 +9,13 @@ require (
 	github.com/temoto/robotstxt v1.1.2
 	github.com/weppos/publicsuffix-go v0.40.2
 	github.com/whois-api-llc/whois-api-go v1.0.0
+	golang.org/x/net v0.27.0
 )
 
 require (
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	golang.org/x/mod v0.18.0 // indirect
-	golang.org/x/net v0.27.0 // indirect
 	golang.org/x/sync v0.7.0 // indirect
 	golang.org/x/sys v0.25.0 // indirect
 	golang.org/x/text v0.16.0 // indirect